@@ -0,0 +1,254 @@
+// Command mock-oidc is a minimal OpenID Connect provider for local development
+// and testing of single sign-on. It signs in whoever submits the form on its
+// authorize page, so it must never be exposed outside a developer machine.
+//
+// Run it and point the API at it:
+//
+//	go run ./cmd/mock-oidc
+//	OIDC_PROVIDERS=mock OIDC_MOCK_ISSUER=http://localhost:9000 \
+//	OIDC_MOCK_CLIENT_ID=nordik-drive OIDC_MOCK_CLIENT_SECRET=secret go run ./cmd/server
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"html/template"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const keyID = "mock-key"
+
+type authCode struct {
+	clientID      string
+	redirectURI   string
+	nonce         string
+	codeChallenge string
+	email         string
+	emailVerified bool
+	name          string
+	expiresAt     time.Time
+}
+
+type provider struct {
+	issuer       string
+	clientID     string
+	clientSecret string
+	key          *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]authCode
+}
+
+var authorizePage = template.Must(template.New("authorize").Parse(`<!DOCTYPE html>
+<html><body style="font-family: sans-serif; max-width: 420px; margin: 40px auto;">
+<h2>Mock OIDC sign-in</h2>
+<form method="post">
+  {{range $k, $v := .Query}}<input type="hidden" name="{{$k}}" value="{{index $v 0}}">{{end}}
+  <p><label>Email<br><input name="email" value="{{.Email}}" size="40"></label></p>
+  <p><label>Name<br><input name="name" value="Test User" size="40"></label></p>
+  <p><label><input type="checkbox" name="email_verified" value="true" checked> Email verified</label></p>
+  <button type="submit">Sign in</button>
+</form>
+</body></html>`))
+
+func main() {
+	port := getEnv("PORT", "9000")
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	p := &provider{
+		issuer:       getEnv("MOCK_OIDC_ISSUER", "http://localhost:"+port),
+		clientID:     getEnv("MOCK_OIDC_CLIENT_ID", "nordik-drive"),
+		clientSecret: getEnv("MOCK_OIDC_CLIENT_SECRET", "secret"),
+		key:          key,
+		codes:        map[string]authCode{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("/authorize", p.authorize)
+	mux.HandleFunc("/token", p.token)
+	mux.HandleFunc("/jwks", p.jwks)
+
+	log.Printf("Mock OIDC provider %s (client %s)", p.issuer, p.clientID)
+	log.Fatal(http.ListenAndServe("127.0.0.1:"+port, mux))
+}
+
+func (p *provider) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                p.issuer,
+		"authorization_endpoint":                p.issuer + "/authorize",
+		"token_endpoint":                        p.issuer + "/token",
+		"jwks_uri":                              p.issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+// authorize shows a form on GET and issues a code for the submitted identity
+// on POST. Setting MOCK_OIDC_EMAIL skips the form.
+func (p *provider) authorize(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	email := r.Form.Get("email")
+	if r.Method == http.MethodGet {
+		email = os.Getenv("MOCK_OIDC_EMAIL")
+		if email == "" {
+			authorizePage.Execute(w, map[string]interface{}{"Query": r.URL.Query(), "Email": r.Form.Get("login_hint")})
+			return
+		}
+	}
+
+	if r.Form.Get("client_id") != p.clientID || r.Form.Get("response_type") != "code" {
+		http.Error(w, "unknown client or unsupported response type", http.StatusBadRequest)
+		return
+	}
+	redirectURI, err := url.Parse(r.Form.Get("redirect_uri"))
+	if err != nil || redirectURI.Scheme == "" {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	code := randomString()
+	p.mu.Lock()
+	p.codes[code] = authCode{
+		clientID:      p.clientID,
+		redirectURI:   redirectURI.String(),
+		nonce:         r.Form.Get("nonce"),
+		codeChallenge: r.Form.Get("code_challenge"),
+		email:         email,
+		emailVerified: r.Method == http.MethodGet || r.Form.Get("email_verified") == "true",
+		name:          getOr(r.Form.Get("name"), "Test User"),
+		expiresAt:     time.Now().Add(time.Minute),
+	}
+	p.mu.Unlock()
+
+	q := redirectURI.Query()
+	q.Set("code", code)
+	q.Set("state", r.Form.Get("state"))
+	redirectURI.RawQuery = q.Encode()
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+func (p *provider) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.Method != http.MethodPost {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	clientID, secret, ok := r.BasicAuth()
+	if !ok {
+		clientID, secret = r.Form.Get("client_id"), r.Form.Get("client_secret")
+	}
+	if clientID != p.clientID || secret != p.clientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	p.mu.Lock()
+	code, ok := p.codes[r.Form.Get("code")]
+	delete(p.codes, r.Form.Get("code"))
+	p.mu.Unlock()
+
+	if !ok || time.Now().After(code.expiresAt) || code.redirectURI != r.Form.Get("redirect_uri") {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+	if code.codeChallenge != "" {
+		sum := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+		if base64.RawURLEncoding.EncodeToString(sum[:]) != code.codeChallenge {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "PKCE verification failed"})
+			return
+		}
+	}
+
+	given, family, _ := strings.Cut(code.name, " ")
+	now := time.Now()
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":            p.issuer,
+		"aud":            p.clientID,
+		"sub":            "mock|" + strings.ToLower(code.email),
+		"email":          code.email,
+		"email_verified": code.emailVerified,
+		"name":           code.name,
+		"given_name":     given,
+		"family_name":    family,
+		"nonce":          code.nonce,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+	})
+	idToken.Header["kid"] = keyID
+
+	signed, err := idToken.SignedString(p.key)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     signed,
+	})
+}
+
+func (p *provider) jwks(w http.ResponseWriter, r *http.Request) {
+	pub := p.key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": keyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func randomString() string {
+	b := make([]byte, 24)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func getEnv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func getOr(v, fallback string) string {
+	if v == "" {
+		return fallback
+	}
+	return v
+}
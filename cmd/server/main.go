@@ -1,14 +1,27 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"net/http"
 	"nordik-drive-api/config"
 	"nordik-drive-api/internal/auth"
 	"nordik-drive-api/internal/chat"
+	"nordik-drive-api/internal/community"
 	"nordik-drive-api/internal/file"
+	"nordik-drive-api/internal/group"
+	"nordik-drive-api/internal/invite"
 	"nordik-drive-api/internal/logs"
+	"nordik-drive-api/internal/mailer"
+	"nordik-drive-api/internal/middlewares"
+	"nordik-drive-api/internal/password"
 	"nordik-drive-api/internal/role"
+	"nordik-drive-api/internal/signing"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -36,30 +49,113 @@ func main() {
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"http://localhost:3000", "http://34.145.18.109/", "https://nordik-drive-react-724838782318.us-west1.run.app"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", middlewares.RequestIDHeader},
+		ExposeHeaders:    []string{middlewares.RequestIDHeader},
 		AllowCredentials: true,
 	}))
 
-	logService := &logs.LogService{DB: db}
-	userService := &auth.AuthService{DB: db, CFG: &cfg}
+	r.Use(middlewares.RequestID())
+
+	mail := mailer.New(&cfg)
+
+	if len(cfg.JWTSecret) < config.MinSecretLength {
+		log.Fatalf("JWT_SECRET must be set to at least %d characters, for example with \"openssl rand -hex 32\"", config.MinSecretLength)
+	}
+
+	// an ephemeral key invalidates every token on restart and isn't shared
+	// between instances, so it has to be asked for
+	var keys *signing.KeySet
+	switch {
+	case len(cfg.JWTSigningKeys) > 0:
+		keys, err = signing.Load(cfg.JWTSigningKeys, cfg.JWTActiveKID, cfg.JWTIssuer, cfg.JWTAudience)
+	case cfg.JWTEphemeral:
+		log.Printf("JWT_EPHEMERAL_KEYS is set, access tokens will not survive a restart")
+		keys, err = signing.Ephemeral(cfg.JWTIssuer, cfg.JWTAudience)
+	default:
+		log.Fatal("JWT_SIGNING_KEYS is not set; set JWT_EPHEMERAL_KEYS=true for local development")
+	}
+	if err != nil {
+		log.Fatal("Failed to load JWT signing keys:", err)
+	}
+	middlewares.AccessTokens = keys
+
+	passwords, err := password.New(&cfg)
+	if err != nil {
+		log.Fatal("Failed to load password policy:", err)
+	}
+
+	if len(cfg.AuditKey) < logs.MinAuditKeyLength {
+		log.Fatalf("AUDIT_CHAIN_KEY must be set to at least %d characters, for example with \"openssl rand -hex 32\"", logs.MinAuditKeyLength)
+	}
+
+	logService := &logs.LogService{DB: db, AuditKey: []byte(cfg.AuditKey)}
+	logService.Start(logs.WriterConfig{
+		QueueSize:     cfg.LogQueueSize,
+		BatchSize:     cfg.LogBatchSize,
+		FlushInterval: cfg.LogFlushInterval,
+		Overflow:      cfg.LogOverflow,
+		SpillFile:     cfg.LogSpillFile,
+	})
+	logService.StartRetention(logs.RetentionPolicy{
+		Days:       cfg.LogRetentionDays,
+		ArchiveDir: cfg.LogArchiveDir,
+	}, time.Hour)
+	userService := &auth.AuthService{DB: db, CFG: &cfg, Mailer: mail, OIDC: auth.NewOIDCProviders(&cfg), Keys: keys, Passwords: passwords}
 	auth.RegisterRoutes(r, userService, logService)
+	userService.StartSessionSweeper(time.Hour)
+	middlewares.TokenValidator = userService.ValidateAccessClaims
+	middlewares.BearerAuthenticator = userService.AuthenticateBearer
 
-	fileService := &file.FileService{DB: db}
+	fileService := &file.FileService{DB: db, CFG: &cfg, Mailer: mail, Auth: userService}
 	file.RegisterRoutes(r, fileService, logService)
+	fileService.StartAccessSweeper(time.Hour)
+
+	communityService := &community.CommunityService{DB: db}
+	community.RegisterRoutes(r, communityService, logService)
+
+	groupService := &group.GroupService{DB: db}
+	group.RegisterRoutes(r, groupService, logService)
+
+	inviteService := &invite.InviteService{DB: db, CFG: &cfg, Mailer: mail, Passwords: passwords}
+	invite.RegisterRoutes(r, inviteService, logService)
 
 	roleService := &role.RoleService{DB: db}
 	role.RegisterRoutes(r, roleService)
 
 	logs.RegisterRoutes(r, logService)
 
-	chatService := &chat.ChatService{DB: db}
-	chat.RegisterRoutes(r, chatService)
+	chatService := &chat.ChatService{DB: db, FileService: fileService}
+	chat.RegisterRoutes(r, chatService, logService)
 
 	// --- Cloud Run expects plain HTTP, on $PORT, bind to 0.0.0.0 ---
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
 	}
-	log.Printf("Starting server on 0.0.0.0:%s ...", port)
-	log.Fatal(r.Run("0.0.0.0:" + port))
+	srv := &http.Server{Addr: "0.0.0.0:" + port, Handler: r}
+	srv.RegisterOnShutdown(logService.CloseStreams)
+
+	// Cloud Run sends SIGTERM and allows a few seconds before killing the
+	// container, enough to finish requests and flush queued logs
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		log.Printf("Starting server on 0.0.0.0:%s ...", port)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Println("Shutting down ...")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Server shutdown: %v", err)
+	}
+	if err := logService.Close(shutdownCtx); err != nil {
+		log.Printf("Log flush: %v", err)
+	}
 }
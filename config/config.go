@@ -2,19 +2,95 @@ package config
 
 import (
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// MinSecretLength is the shortest JWTSecret the server starts with. HMAC
+// accepts an empty key, so a missing secret would let anyone mint tokens.
+const MinSecretLength = 32
+
 type Config struct {
 	DBHost     string
 	DBPort     string
 	DBUser     string
 	DBPassword string
 	DBName     string
-	JWTSecret  string
-	GeminiKey  string
-	SMTPKey    string
-	GmailUser  string
-	GmailPass  string
+	// JWTSecret keys the HMAC tokens: login challenges, email verification,
+	// OIDC state, share links and OTP hashes. It must be at least
+	// MinSecretLength bytes.
+	JWTSecret string
+	// Access token signing, see signing.Load. JWT_SIGNING_KEYS is a comma
+	// separated list of PEM files, for example generated with
+	// "openssl genpkey -algorithm ed25519 -out jwt-1.pem". JWTEphemeral
+	// (JWT_EPHEMERAL_KEYS=true) starts without them using a key that dies
+	// with the process, for local development only.
+	JWTSigningKeys []string
+	JWTActiveKID   string
+	JWTIssuer      string
+	JWTAudience    string
+	JWTEphemeral   bool
+	GeminiKey      string
+	SMTPKey        string
+	GmailUser      string
+	GmailPass      string
+	TOTPKey        string
+	// AuditKey keys the audit log hash chain
+	AuditKey string
+
+	// Mail delivery, see mailer.New
+	MailDriver  string
+	MailFrom    string
+	MailDropDir string
+	SMTPHost    string
+	SMTPPort    string
+
+	// Password policy, see password.New. PasswordClasses lists the required
+	// character classes out of upper, lower, digit and symbol;
+	// BreachedPasswordsFile holds SHA-1 hashes, one per line
+	PasswordMinLength     int
+	PasswordClasses       []string
+	PasswordHistory       int
+	BreachedPasswordsFile string
+
+	// Asynchronous log writer, see logs.WriterConfig. LogOverflow is block,
+	// drop or spill
+	LogQueueSize     int
+	LogBatchSize     int
+	LogFlushInterval time.Duration
+	LogOverflow      string
+	LogSpillFile     string
+
+	// Log retention, see logs.RetentionPolicy. LOG_RETENTION_DAYS maps levels
+	// to days, for example "*=90,WARN=365,ERROR=365"; unset keeps everything
+	LogRetentionDays map[string]int
+	LogArchiveDir    string
+
+	// AppURL is the frontend origin used to build links in emails
+	AppURL string
+	// AllowSignup turns off open self-signup when false, leaving invitations
+	// as the only way to create accounts
+	AllowSignup bool
+
+	// Single sign-on, see OIDCProviderConfig
+	OIDCProviders []OIDCProviderConfig
+	// OIDCRedirectBaseURL is the public URL of this API, used to build the
+	// callback URL registered with each provider
+	OIDCRedirectBaseURL string
+	OIDCAutoProvision   bool
+	OIDCDefaultRole     string
+}
+
+// OIDCProviderConfig is read from OIDC_<NAME>_ISSUER, OIDC_<NAME>_CLIENT_ID,
+// OIDC_<NAME>_CLIENT_SECRET and OIDC_<NAME>_TRUST_EMAIL for every name listed
+// in OIDC_PROVIDERS
+type OIDCProviderConfig struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	TrustEmail   bool
 }
 
 func LoadConfig() Config {
@@ -25,8 +101,112 @@ func LoadConfig() Config {
 		DBPassword: os.Getenv("DB_PASSWORD"),
 		DBName:     os.Getenv("DB_NAME"),
 		JWTSecret:  os.Getenv("JWT_SECRET"),
-		GeminiKey:  os.Getenv("GEMINI_KEY"),
-		GmailUser:  os.Getenv("GMAIL_USER"),
-		GmailPass:  os.Getenv("GMAIL_APP_PASSWORD"),
+
+		JWTSigningKeys: splitList(os.Getenv("JWT_SIGNING_KEYS")),
+		JWTActiveKID:   os.Getenv("JWT_ACTIVE_KID"),
+		JWTIssuer:      getEnv("JWT_ISSUER", "nordik-drive-api"),
+		JWTAudience:    getEnv("JWT_AUDIENCE", "nordik-drive"),
+		JWTEphemeral:   os.Getenv("JWT_EPHEMERAL_KEYS") == "true",
+
+		GeminiKey: os.Getenv("GEMINI_KEY"),
+		GmailUser: os.Getenv("GMAIL_USER"),
+		GmailPass: os.Getenv("GMAIL_APP_PASSWORD"),
+		TOTPKey:   os.Getenv("TOTP_ENCRYPTION_KEY"),
+		AuditKey:  os.Getenv("AUDIT_CHAIN_KEY"),
+
+		MailDriver:  os.Getenv("MAIL_DRIVER"),
+		MailFrom:    os.Getenv("MAIL_FROM"),
+		MailDropDir: os.Getenv("MAIL_DROP_DIR"),
+		SMTPHost:    getEnv("SMTP_HOST", "smtp.gmail.com"),
+		SMTPPort:    getEnv("SMTP_PORT", "587"),
+
+		PasswordMinLength:     getEnvInt("PASSWORD_MIN_LENGTH", 8),
+		PasswordClasses:       splitList(os.Getenv("PASSWORD_CLASSES")),
+		PasswordHistory:       getEnvInt("PASSWORD_HISTORY", 5),
+		BreachedPasswordsFile: os.Getenv("BREACHED_PASSWORDS_FILE"),
+
+		LogQueueSize:     getEnvInt("LOG_QUEUE_SIZE", 1024),
+		LogBatchSize:     getEnvInt("LOG_BATCH_SIZE", 100),
+		LogFlushInterval: getEnvDuration("LOG_FLUSH_INTERVAL", time.Second),
+		LogOverflow:      getEnv("LOG_OVERFLOW", "spill"),
+		LogSpillFile:     getEnv("LOG_SPILL_FILE", "log-spill.ndjson"),
+		LogRetentionDays: parseLevelDays(os.Getenv("LOG_RETENTION_DAYS")),
+		LogArchiveDir:    getEnv("LOG_ARCHIVE_DIR", "log-archive"),
+
+		AppURL:      getEnv("APP_URL", "http://localhost:3000"),
+		AllowSignup: getEnv("ALLOW_SIGNUP", "true") != "false",
+
+		OIDCProviders:       loadOIDCProviders(),
+		OIDCRedirectBaseURL: getEnv("OIDC_REDIRECT_BASE_URL", "http://localhost:8080"),
+		OIDCAutoProvision:   os.Getenv("OIDC_AUTO_PROVISION") == "true",
+		OIDCDefaultRole:     getEnv("OIDC_DEFAULT_ROLE", "User"),
+	}
+}
+
+func loadOIDCProviders() []OIDCProviderConfig {
+	var providers []OIDCProviderConfig
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		providers = append(providers, OIDCProviderConfig{
+			Name:         name,
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			TrustEmail:   os.Getenv(prefix+"TRUST_EMAIL") == "true",
+		})
+	}
+	return providers
+}
+
+// parseLevelDays reads LEVEL=DAYS pairs, skipping malformed ones
+func parseLevelDays(v string) map[string]int {
+	days := map[string]int{}
+	for _, item := range splitList(v) {
+		level, n, ok := strings.Cut(item, "=")
+		if !ok {
+			continue
+		}
+		d, err := strconv.Atoi(strings.TrimSpace(n))
+		if err != nil || d <= 0 {
+			continue
+		}
+		days[strings.ToUpper(strings.TrimSpace(level))] = d
+	}
+	return days
+}
+
+func splitList(v string) []string {
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func getEnv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func getEnvInt(key string, fallback int) int {
+	if v, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return v
+	}
+	return fallback
+}
+
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	if v, err := time.ParseDuration(os.Getenv(key)); err == nil {
+		return v
 	}
+	return fallback
 }
@@ -1,7 +1,12 @@
 CREATE TABLE IF NOT EXISTS roles (
     id SERIAL PRIMARY KEY,
     role VARCHAR(100) NOT NULL UNIQUE,
-    priority INT NOT NULL
+    priority INT NOT NULL,
+    can_upload BOOLEAN NOT NULL DEFAULT FALSE,
+    can_view BOOLEAN NOT NULL DEFAULT FALSE,
+    can_approve BOOLEAN NOT NULL DEFAULT FALSE,
+    can_approve_all BOOLEAN NOT NULL DEFAULT FALSE,
+    require_two_factor BOOLEAN NOT NULL DEFAULT FALSE
 );
 
 CREATE TABLE IF NOT EXISTS users (
@@ -13,15 +18,141 @@ CREATE TABLE IF NOT EXISTS users (
     role VARCHAR(100) NOT NULL DEFAULT 'User'
         REFERENCES roles(role) ON DELETE CASCADE,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    email_verified_at TIMESTAMP NULL,
+    disabled_at TIMESTAMP NULL,
+    password_reset_required BOOLEAN NOT NULL DEFAULT FALSE
 );
 
-CREATE TABLE otps (
-    id BIGINT PRIMARY KEY,
+-- Login requires a verified email. Accounts that predate verification are
+-- treated as verified; the backfill only runs when the column is added so
+-- re-running this file never verifies a pending signup.
+DO $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM information_schema.columns
+        WHERE table_name = 'users' AND column_name = 'email_verified_at'
+    ) THEN
+        ALTER TABLE users ADD COLUMN email_verified_at TIMESTAMP NULL;
+        UPDATE users SET email_verified_at = COALESCE(created_at, NOW()) WHERE email_verified_at IS NULL;
+    END IF;
+END $$;
+
+CREATE TABLE IF NOT EXISTS user_invitations (
+    id SERIAL PRIMARY KEY,
+    email VARCHAR(100) NOT NULL,
+    role VARCHAR(100) NOT NULL REFERENCES roles(role) ON DELETE CASCADE,
+    community_name VARCHAR(255),
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    invited_by INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    expires_at TIMESTAMP NOT NULL,
+    accepted_at TIMESTAMP NULL,
+    accepted_user_id INT NULL REFERENCES users(id) ON DELETE SET NULL,
+    revoked_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_invitations_email ON user_invitations(email);
+
+CREATE TABLE IF NOT EXISTS user_identities (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider VARCHAR(50) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    email VARCHAR(100),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    last_login_at TIMESTAMP NULL,
+    CONSTRAINT unique_identity_subject UNIQUE (provider, subject)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_identities_user_id ON user_identities(user_id);
+
+CREATE TABLE IF NOT EXISTS personal_access_tokens (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    prefix VARCHAR(16) NOT NULL,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    scopes JSONB NOT NULL DEFAULT '[]',
+    expires_at TIMESTAMP NOT NULL,
+    last_used_at TIMESTAMP NULL,
+    last_used_ip VARCHAR(64),
+    revoked_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_personal_access_tokens_user_id ON personal_access_tokens(user_id);
+
+CREATE TABLE IF NOT EXISTS user_sessions (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    user_agent TEXT,
+    ip_address VARCHAR(64),
+    remember_me BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    last_used_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP NULL,
+    revoked_reason VARCHAR(255)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_sessions_user_id ON user_sessions(user_id);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id SERIAL PRIMARY KEY,
+    session_id INT NOT NULL REFERENCES user_sessions(id) ON DELETE CASCADE,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_session_id ON refresh_tokens(session_id);
+
+CREATE TABLE IF NOT EXISTS user_totp (
+    user_id INT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    secret TEXT NOT NULL,
+    enabled_at TIMESTAMP NULL,
+    last_used_step BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash VARCHAR(64) NOT NULL,
+    used_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_recovery_codes_user_id ON recovery_codes(user_id);
+
+CREATE TABLE IF NOT EXISTS password_history (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    password VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_password_history_user_id ON password_history(user_id);
+
+-- email is stored lowercased
+CREATE TABLE IF NOT EXISTS otps (
+    id BIGSERIAL PRIMARY KEY,
     email VARCHAR(255) NOT NULL,
-    code VARCHAR(6) NOT NULL,
-    created_at TIMESTAMP NOT NULL,
-    INDEX idx_email (email)
+    code_hash VARCHAR(64) NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    used_at TIMESTAMP NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_otps_email ON otps(email);
+
+CREATE TABLE IF NOT EXISTS auth_throttle (
+    throttle_key VARCHAR(255) PRIMARY KEY,
+    failures INT NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMP NOT NULL,
+    locked_until TIMESTAMP NULL
 );
 
 
@@ -61,18 +192,89 @@ CREATE TABLE IF NOT EXISTS file_data (
     version INT DEFAULT 1 NOT NULL
 );
 
-CREATE TABLE IF NOT EXISTS file_access (
+CREATE TABLE IF NOT EXISTS user_groups (
     id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL UNIQUE,
+    description TEXT,
+    created_by INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS user_group_members (
+    id SERIAL PRIMARY KEY,
+    group_id INT NOT NULL REFERENCES user_groups(id) ON DELETE CASCADE,
     user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT unique_group_member UNIQUE (group_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_group_members_user_id ON user_group_members(user_id);
+
+CREATE TABLE IF NOT EXISTS file_access (
+    id SERIAL PRIMARY KEY,
+    user_id INT NULL REFERENCES users(id) ON DELETE CASCADE,
+    group_id INT NULL REFERENCES user_groups(id) ON DELETE CASCADE,
     file_id INT NOT NULL REFERENCES file(id) ON DELETE CASCADE,
-    CONSTRAINT unique_user_file UNIQUE (user_id, file_id)
-)
+    access_level VARCHAR(20) NOT NULL DEFAULT 'view'
+        CHECK (access_level IN ('view', 'export', 'edit')),
+    reason TEXT,
+    granted_by INT REFERENCES users(id) ON DELETE SET NULL,
+    expires_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT unique_user_file UNIQUE (user_id, file_id),
+    CONSTRAINT unique_group_file UNIQUE (group_id, file_id),
+    CONSTRAINT file_access_target CHECK ((user_id IS NULL) <> (group_id IS NULL))
+);
 
--- CREATE TABLE IF NOT EXISTS community (
---     id SERIAL PRIMARY KEY,
---     community_name VARCHAR(255) NOT NULL UNIQUE,
---     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
--- ); 
+CREATE INDEX IF NOT EXISTS idx_file_access_expires_at ON file_access(expires_at);
+
+CREATE TABLE IF NOT EXISTS file_policy (
+    id SERIAL PRIMARY KEY,
+    file_id INT NOT NULL REFERENCES file(id) ON DELETE CASCADE,
+    policy_type VARCHAR(20) NOT NULL CHECK (policy_type IN ('column', 'row')),
+    column_name VARCHAR(255) NOT NULL,
+    action VARCHAR(20) NOT NULL CHECK (action IN ('hide', 'mask', 'equals', 'not_equals')),
+    value TEXT,
+    exempt_roles JSONB NOT NULL DEFAULT '[]',
+    created_by INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_file_policy_file_id ON file_policy(file_id);
+
+CREATE TABLE IF NOT EXISTS file_share_link (
+    id SERIAL PRIMARY KEY,
+    file_id INT NOT NULL REFERENCES file(id) ON DELETE CASCADE,
+    version INT NOT NULL,
+    password_hash TEXT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    max_uses INT NULL,
+    use_count INT NOT NULL DEFAULT 0,
+    last_used_at TIMESTAMP NULL,
+    revoked_at TIMESTAMP NULL,
+    created_by INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_file_share_link_file_id ON file_share_link(file_id);
+
+CREATE TABLE IF NOT EXISTS community (
+    id SERIAL PRIMARY KEY,
+    community_name VARCHAR(255) NOT NULL UNIQUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS file_community (
+    id SERIAL PRIMARY KEY,
+    file_id INT NOT NULL REFERENCES file(id) ON DELETE CASCADE,
+    community_id INT NOT NULL REFERENCES community(id) ON DELETE CASCADE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT unique_file_community UNIQUE (file_id, community_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_file_community_community_id ON file_community(community_id);
 
 -- CREATE TABLE IF NOT EXISTS access (
 --     id SERIAL PRIMARY KEY,
@@ -87,20 +289,29 @@ CREATE TABLE IF NOT EXISTS file_access (
 -- ADD COLUMN status VARCHAR(255) NOT NULL DEFAULT 'pending',
 -- ADD CONSTRAINT status_check CHECK (status IN ('pending', 'approved', 'rejected'));
 
--- CREATE TABLE IF NOT EXISTS user_roles (
---     id SERIAL PRIMARY KEY,
---     role VARCHAR(100) NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
---     user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
---     community_name VARCHAR(255)
--- );
+-- Community roles. community_name has no foreign key because renames are
+-- applied to this table by the community service.
+CREATE TABLE IF NOT EXISTS user_roles (
+    id SERIAL PRIMARY KEY,
+    role VARCHAR(100) NOT NULL REFERENCES roles(role) ON DELETE CASCADE,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    community_name VARCHAR(255)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_roles_user_id ON user_roles(user_id);
+CREATE INDEX IF NOT EXISTS idx_user_roles_community_name ON user_roles(community_name);
 
 
 -- CREATE INDEX IF NOT EXISTS idx_file_data_file_id ON file_data(file_id);
 
-INSERT INTO roles (role, priority)
+-- Managers invite users into their communities, so they rank between
+-- Admin and User
+INSERT INTO roles (role, priority, can_upload, can_view, can_approve, can_approve_all)
 VALUES
-    ('Admin',        1),
-    ('User',         2);
+    ('Admin',        1, TRUE,  TRUE, TRUE,  TRUE),
+    ('Manager',      2, TRUE,  TRUE, TRUE,  FALSE),
+    ('User',         3, FALSE, TRUE, FALSE, FALSE)
+ON CONFLICT (role) DO NOTHING;
 
 -- INSERT INTO community (community_name) VALUES
 -- ('Shoal Lake 40 First Nation'),
@@ -141,11 +352,62 @@ CREATE TABLE logs (
     action VARCHAR(50) NOT NULL,
     message TEXT NOT NULL,
     metadata JSONB NULL,
+    target_type VARCHAR(50) NULL,
+    target_id INT NULL,
+    before JSONB NULL,
+    after JSONB NULL,
+    request_id VARCHAR(64) NULL,
+    ip VARCHAR(64) NULL,
+    user_agent TEXT NULL,
     created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
 );
 
 CREATE INDEX idx_logs_user_id ON logs(user_id);
+CREATE INDEX idx_logs_target ON logs(target_type, target_id);
+CREATE INDEX idx_logs_request_id ON logs(request_id);
 CREATE INDEX idx_logs_service ON logs(service);
 CREATE INDEX idx_logs_created_at ON logs(created_at);
 
 
+
+-- Hash-chained copy of security-relevant log entries, see logs.AuditEntry.
+-- Rows can only be appended.
+CREATE TABLE IF NOT EXISTS audit_log (
+    id BIGINT PRIMARY KEY,
+    log_id INT NOT NULL,
+    level VARCHAR(20) NOT NULL,
+    service VARCHAR(100) NOT NULL,
+    user_id INT NULL,
+    action VARCHAR(255) NOT NULL,
+    message TEXT NOT NULL,
+    metadata TEXT NULL,
+    target_type VARCHAR(50) NULL,
+    target_id INT NULL,
+    before TEXT NULL,
+    after TEXT NULL,
+    request_id VARCHAR(64) NULL,
+    ip VARCHAR(64) NULL,
+    user_agent TEXT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    prev_hash VARCHAR(64) NOT NULL,
+    hash VARCHAR(64) NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_user_id ON audit_log(user_id);
+CREATE INDEX IF NOT EXISTS idx_audit_log_action ON audit_log(action);
+
+CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_log_no_update_delete ON audit_log;
+CREATE TRIGGER audit_log_no_update_delete
+    BEFORE UPDATE OR DELETE ON audit_log
+    FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
+
+DROP TRIGGER IF EXISTS audit_log_no_truncate ON audit_log;
+CREATE TRIGGER audit_log_no_truncate
+    BEFORE TRUNCATE ON audit_log
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_log_append_only();
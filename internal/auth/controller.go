@@ -1,15 +1,20 @@
 package auth
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
-	"nordik-drive-api/config"
+	"net/url"
 	"nordik-drive-api/internal/logs"
+	"nordik-drive-api/internal/middlewares"
+	"nordik-drive-api/internal/password"
 	"nordik-drive-api/internal/util"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 )
 
 type AuthController struct {
@@ -22,7 +27,12 @@ func (ac *AuthController) SignUp(c *gin.Context) {
 		FirstName string `json:"firstname" binding:"required"`
 		LastName  string `json:"lastname" binding:"required"`
 		Email     string `json:"email" binding:"required,email"`
-		Password  string `json:"password" binding:"required,min=6"`
+		Password  string `json:"password" binding:"required"`
+	}
+
+	if !ac.AuthService.CFG.AllowSignup {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Sign up is by invitation only"})
+		return
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -30,6 +40,11 @@ func (ac *AuthController) SignUp(c *gin.Context) {
 		return
 	}
 
+	if err := ac.AuthService.CheckNewPassword(nil, req.Password); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	password, err := util.HashPassword(req.Password)
 
 	if err != nil {
@@ -51,152 +66,1369 @@ func (ac *AuthController) SignUp(c *gin.Context) {
 		return
 	}
 
-	uid := uint(user.ID)
+	uid := uint(newuser.ID)
+
+	ac.LS.Record(c, logs.Event{
+		Service:    "auth",
+		Action:     logs.ActionSignup,
+		Message:    fmt.Sprintf("Account created with email %s", newuser.Email),
+		UserID:     &uid,
+		TargetType: logs.TargetUser,
+		TargetID:   uid,
+	})
+
+	if err := ac.AuthService.SendSignupConfirmation(newuser); err != nil {
+		fmt.Printf("Failed to send verification email to %s: %v\n", newuser.Email, err)
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "User created successfully. Check your email to verify your account.",
+		"user": map[string]interface{}{
+			"id":        newuser.ID,
+			"firstname": newuser.FirstName,
+			"lastname":  newuser.LastName,
+			"email":     newuser.Email,
+		},
+	})
+}
+
+type LoginRequest struct {
+	Email      string `json:"email" binding:"required,email"`
+	Password   string `json:"password" binding:"required"`
+	RememberMe bool   `json:"rememberMe"`
+}
+
+func (ac *AuthController) Login(c *gin.Context) {
+	var req LoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	accountKey := AccountThrottleKey("login", req.Email)
+	ipKey := IPThrottleKey("login", c.ClientIP())
+	if ac.throttled(c, accountKey, ipKey) {
+		return
+	}
+
+	user, err := ac.AuthService.GetUser(req.Email)
+	if err != nil {
+		ac.LS.Record(c, logs.Event{
+			Level:    logs.LevelWarn,
+			Service:  "auth",
+			Action:   logs.ActionLoginFailed,
+			Message:  fmt.Sprintf("Login failed for unknown email: %s", req.Email),
+			Metadata: gin.H{"email": req.Email, "reason": "unknown_email"},
+		})
+		ac.recordFailure(c, nil, accountKey, ipKey)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Oops! We couldn’t log you in. Please check your username and password and try again."})
+		return
+	}
+
+	if err := util.VerifyPassword(req.Password, user.Password); err != nil {
+		uid := uint(user.ID)
+		ac.LS.Record(c, logs.Event{
+			Level:      logs.LevelWarn,
+			Service:    "auth",
+			Action:     logs.ActionLoginFailed,
+			Message:    fmt.Sprintf("Login failed with a wrong password for %s", user.Email),
+			UserID:     &uid,
+			TargetType: logs.TargetUser,
+			TargetID:   uid,
+			Metadata:   gin.H{"email": user.Email, "reason": "wrong_password"},
+		})
+		ac.recordFailure(c, &uid, accountKey, ipKey)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Oops! We couldn’t log you in. Please check your username and password and try again."})
+		return
+	}
+
+	if err := ac.AuthService.ResetThrottle(accountKey); err != nil {
+		fmt.Printf("Failed to reset login throttle: %v\n", err)
+	}
+
+	if !loginAllowed(c, user) {
+		return
+	}
+
+	enabled, err := ac.AuthService.TwoFactorEnabled(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if enabled {
+		ac.sendLoginChallenge(c, user, challengeTwoFactor, req.RememberMe)
+		return
+	}
+
+	required, err := ac.AuthService.TwoFactorRequired(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if required {
+		ac.sendLoginChallenge(c, user, challengeSetup, req.RememberMe)
+		return
+	}
+
+	ac.completeLogin(c, user, req.RememberMe, nil)
+}
+
+// loginAllowed writes the error response itself and returns false when the
+// account may not sign in. The two-factor steps call it again because the
+// account can change between the password and the code.
+func loginAllowed(c *gin.Context, user *Auth) bool {
+	if user.DisabledAt != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": ErrAccountDisabled.Error()})
+		return false
+	}
+
+	if user.EmailVerifiedAt == nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": ErrEmailNotVerified.Error(), "email_verified": false})
+		return false
+	}
+
+	if user.PasswordResetRequired {
+		c.JSON(http.StatusForbidden, gin.H{"error": ErrPasswordReset.Error(), "password_reset_required": true})
+		return false
+	}
+
+	return true
+}
+
+// sendLoginChallenge answers a correct password without issuing cookies; the
+// client finishes the login with the challenge on one of the /login/2fa routes
+func (ac *AuthController) sendLoginChallenge(c *gin.Context, user *Auth, purpose string, rememberMe bool) {
+	challenge, err := ac.AuthService.SignLoginChallenge(user.ID, purpose, rememberMe)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if purpose == challengeSetup {
+		c.JSON(http.StatusOK, gin.H{
+			"message":                   "Two-factor setup required",
+			"two_factor_setup_required": true,
+			"challenge":                 challenge,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":             "Two-factor code required",
+		"two_factor_required": true,
+		"challenge":           challenge,
+	})
+}
+
+// startSession creates a session, sets the auth cookies and logs the login.
+// method is "password" or the name of the SSO provider.
+func (ac *AuthController) startSession(c *gin.Context, user *Auth, rememberMe bool, method string) error {
+	session, refreshToken, err := ac.AuthService.CreateSession(user.ID, rememberMe, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		return err
+	}
+
+	accessToken, err := ac.AuthService.SignAccessToken(user.ID, session.ID)
+	if err != nil {
+		return err
+	}
+
+	setAuthCookies(c, accessToken, refreshToken)
+
+	uid := uint(user.ID)
+
+	ac.LS.Record(c, logs.Event{
+		Service:    "auth",
+		Action:     logs.ActionLogin,
+		Message:    fmt.Sprintf("User logged in with email: %s", user.Email),
+		UserID:     &uid,
+		TargetType: logs.TargetSession,
+		TargetID:   session.ID,
+		Metadata:   gin.H{"email": user.Email, "remember_me": rememberMe, "method": method},
+	})
+	return nil
+}
+
+// completeLogin starts a session and writes the login response
+func (ac *AuthController) completeLogin(c *gin.Context, user *Auth, rememberMe bool, extra gin.H) {
+	if err := ac.startSession(c, user, rememberMe, "password"); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	res := gin.H{
+		"message": "Login successful",
+		"data": LoginResponse{
+			ID:        user.ID,
+			FirstName: user.FirstName,
+			LastName:  user.LastName,
+			Email:     user.Email,
+			Role:      user.Role,
+		},
+	}
+	for k, v := range extra {
+		res[k] = v
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+// LoginTwoFactor finishes a login with an authenticator or recovery code
+func (ac *AuthController) LoginTwoFactor(c *gin.Context) {
+	var req TwoFactorLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, rememberMe, err := ac.AuthService.ParseLoginChallenge(req.Challenge, challengeTwoFactor)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := ac.AuthService.GetUserByID(userID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+
+	uid := uint(user.ID)
+
+	accountKey := AccountThrottleKey("2fa", strconv.Itoa(user.ID))
+	ipKey := IPThrottleKey("2fa", c.ClientIP())
+	if ac.throttled(c, accountKey, ipKey) {
+		return
+	}
+
+	if !loginAllowed(c, user) {
+		return
+	}
+
+	switch {
+	case req.Code != "":
+		err = ac.AuthService.VerifyTOTP(user.ID, req.Code)
+	case req.RecoveryCode != "":
+		err = ac.AuthService.UseRecoveryCode(user.ID, req.RecoveryCode)
+		if err == nil {
+			ac.LS.Record(c, logs.Event{
+				Level:      logs.LevelWarn,
+				Service:    "auth",
+				Action:     logs.ActionRecoveryCodeUsed,
+				Message:    fmt.Sprintf("Recovery code used by %s", user.Email),
+				UserID:     &uid,
+				TargetType: logs.TargetUser,
+				TargetID:   uid,
+			})
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code or recovery_code is required"})
+		return
+	}
+	if err != nil {
+		ac.LS.Record(c, logs.Event{
+			Level:      logs.LevelWarn,
+			Service:    "auth",
+			Action:     logs.ActionTwoFactorFailed,
+			Message:    fmt.Sprintf("Invalid two-factor code for %s", user.Email),
+			UserID:     &uid,
+			TargetType: logs.TargetUser,
+			TargetID:   uid,
+		})
+		ac.recordFailure(c, &uid, accountKey, ipKey)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": ErrTwoFactorInvalidCode.Error()})
+		return
+	}
+
+	if err := ac.AuthService.ResetThrottle(accountKey); err != nil {
+		fmt.Printf("Failed to reset two-factor throttle: %v\n", err)
+	}
+
+	ac.completeLogin(c, user, rememberMe, nil)
+}
+
+// LoginTwoFactorSetup starts enrolment for a user whose role enforces 2FA
+// but who has not enrolled yet
+func (ac *AuthController) LoginTwoFactorSetup(c *gin.Context) {
+	var req struct {
+		Challenge string `json:"challenge" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ipKey := IPThrottleKey("2fa", c.ClientIP())
+	if ac.throttled(c, ipKey) {
+		return
+	}
+
+	userID, _, err := ac.AuthService.ParseLoginChallenge(req.Challenge, challengeSetup)
+	if err != nil {
+		ac.recordFailure(c, nil, ipKey)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := ac.AuthService.GetUserByID(userID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+
+	// a locked account can't restart enrolment to get a fresh secret
+	accountKey := AccountThrottleKey("2fa", strconv.Itoa(user.ID))
+	if ac.throttled(c, accountKey, ipKey) {
+		return
+	}
+
+	if !loginAllowed(c, user) {
+		return
+	}
+
+	setup, err := ac.AuthService.BeginTOTPSetup(user)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Scan the code with your authenticator app",
+		"data":    setup,
+	})
+}
+
+// LoginTwoFactorActivate confirms enrolment started from a setup challenge
+// and completes the login
+func (ac *AuthController) LoginTwoFactorActivate(c *gin.Context) {
+	var req TwoFactorLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, rememberMe, err := ac.AuthService.ParseLoginChallenge(req.Challenge, challengeSetup)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := ac.AuthService.GetUserByID(userID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+
+	uid := uint(user.ID)
+
+	accountKey := AccountThrottleKey("2fa", strconv.Itoa(user.ID))
+	ipKey := IPThrottleKey("2fa", c.ClientIP())
+	if ac.throttled(c, accountKey, ipKey) {
+		return
+	}
+
+	if !loginAllowed(c, user) {
+		return
+	}
+
+	codes, err := ac.AuthService.ActivateTOTP(user.ID, req.Code)
+	if err != nil {
+		if errors.Is(err, ErrTwoFactorInvalidCode) {
+			ac.recordFailure(c, &uid, accountKey, ipKey)
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := ac.AuthService.ResetThrottle(accountKey); err != nil {
+		fmt.Printf("Failed to reset two-factor throttle: %v\n", err)
+	}
+
+	ac.LS.Record(c, logs.Event{
+		Service:    "auth",
+		Action:     logs.ActionEnableTwoFactor,
+		Message:    fmt.Sprintf("Two-factor authentication enabled for %s", user.Email),
+		UserID:     &uid,
+		TargetType: logs.TargetUser,
+		TargetID:   uid,
+		Before:     gin.H{"two_factor": false},
+		After:      gin.H{"two_factor": true},
+	})
+
+	ac.completeLogin(c, user, rememberMe, gin.H{"recovery_codes": codes})
+}
+
+func (ac *AuthController) Logout(c *gin.Context) {
+	if refreshToken, err := c.Cookie("refresh_token"); err == nil && refreshToken != "" {
+		if session, err := ac.AuthService.RevokeSessionByToken(refreshToken, "logout"); err == nil {
+			uid := uint(session.UserID)
+			ac.LS.Record(c, logs.Event{
+				Service:    "auth",
+				Action:     logs.ActionLogout,
+				Message:    fmt.Sprintf("Session %d signed out", session.ID),
+				UserID:     &uid,
+				TargetType: logs.TargetSession,
+				TargetID:   session.ID,
+			})
+		}
+	}
+
+	clearAuthCookies(c)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+}
+
+// LogoutAll revokes every session of the caller, signing out all devices
+func (ac *AuthController) LogoutAll(c *gin.Context) {
+	userIDVal, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user ID not found"})
+		return
+	}
+
+	userID, ok := userIDVal.(float64)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user ID"})
+		return
+	}
+
+	revoked, err := ac.AuthService.RevokeAllSessions(int(userID), "logout everywhere")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	uid := uint(userID)
+
+	ac.LS.Record(c, logs.Event{
+		Level:      logs.LevelWarn,
+		Service:    "auth",
+		Action:     logs.ActionLogoutAll,
+		Message:    fmt.Sprintf("Signed out of %d sessions", revoked),
+		UserID:     &uid,
+		TargetType: logs.TargetUser,
+		TargetID:   uid,
+	})
+
+	clearAuthCookies(c)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out of all sessions", "revoked": revoked})
+}
+
+// GetSessions lists the caller's active sessions
+func (ac *AuthController) GetSessions(c *gin.Context) {
+	userIDVal, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user ID not found"})
+		return
+	}
+
+	userID, ok := userIDVal.(float64)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user ID"})
+		return
+	}
+
+	sessions, err := ac.AuthService.GetActiveSessions(int(userID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	currentID := c.GetUint("sessionID")
+	res := make([]SessionResponse, 0, len(sessions))
+	for _, s := range sessions {
+		res = append(res, SessionResponse{
+			ID:         s.ID,
+			UserAgent:  s.UserAgent,
+			IPAddress:  s.IPAddress,
+			CreatedAt:  s.CreatedAt,
+			LastUsedAt: s.LastUsedAt,
+			ExpiresAt:  s.ExpiresAt,
+			Current:    s.ID == currentID,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Sessions fetched successfully",
+		"sessions": res,
+	})
+}
+
+// RevokeSession signs out one of the caller's sessions
+func (ac *AuthController) RevokeSession(c *gin.Context) {
+	userIDVal, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user ID not found"})
+		return
+	}
+
+	userID, ok := userIDVal.(float64)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user ID"})
+		return
+	}
+
+	session, err := ac.AuthService.RevokeUserSession(int(userID), c.Param("id"), "remote sign-out")
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	uid := uint(userID)
+
+	ac.LS.Record(c, logs.Event{
+		Service:    "auth",
+		Action:     logs.ActionRevokeSession,
+		Message:    fmt.Sprintf("Session %d signed out remotely", session.ID),
+		UserID:     &uid,
+		TargetType: logs.TargetSession,
+		TargetID:   session.ID,
+	})
+
+	if session.ID == c.GetUint("sessionID") {
+		clearAuthCookies(c)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session signed out"})
+}
+
+// RevokeUserSessions lets an admin sign a user out of every device
+func (ac *AuthController) RevokeUserSessions(c *gin.Context) {
+	userIDVal, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user ID not found"})
+		return
+	}
+
+	userID, ok := userIDVal.(float64)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user ID"})
+		return
+	}
+
+	admin, err := ac.AuthService.GetUserByID(int(userID))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+	if admin.Role != "Admin" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only admins can revoke sessions of other users"})
+		return
+	}
+
+	targetID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return
+	}
+
+	target, err := ac.AuthService.GetUserByID(targetID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	revoked, err := ac.AuthService.RevokeAllSessions(target.ID, "revoked by admin")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	uid := uint(userID)
+
+	ac.LS.Record(c, logs.Event{
+		Level:      logs.LevelWarn,
+		Service:    "auth",
+		Action:     logs.ActionRevokeUserSessions,
+		Message:    fmt.Sprintf("Signed %s out of %d sessions", target.Email, revoked),
+		UserID:     &uid,
+		TargetType: logs.TargetUser,
+		TargetID:   uint(target.ID),
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "User sessions revoked", "revoked": revoked})
+}
+
+func (ac *AuthController) GetTwoFactorStatus(c *gin.Context) {
+	user, ok := ac.currentUser(c)
+	if !ok {
+		return
+	}
+
+	enabled, err := ac.AuthService.TwoFactorEnabled(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	required, err := ac.AuthService.TwoFactorRequired(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	remaining, err := ac.AuthService.RemainingRecoveryCodes(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":                  enabled,
+		"required":                 required,
+		"recovery_codes_remaining": remaining,
+	})
+}
+
+func (ac *AuthController) SetupTwoFactor(c *gin.Context) {
+	user, ok := ac.currentUser(c)
+	if !ok {
+		return
+	}
+
+	setup, err := ac.AuthService.BeginTOTPSetup(user)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Scan the code with your authenticator app",
+		"data":    setup,
+	})
+}
+
+func (ac *AuthController) ActivateTwoFactor(c *gin.Context) {
+	user, ok := ac.currentUser(c)
+	if !ok {
+		return
+	}
+
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	codes, err := ac.AuthService.ActivateTOTP(user.ID, req.Code)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	uid := uint(user.ID)
+
+	ac.LS.Record(c, logs.Event{
+		Service:    "auth",
+		Action:     logs.ActionEnableTwoFactor,
+		Message:    fmt.Sprintf("Two-factor authentication enabled for %s", user.Email),
+		UserID:     &uid,
+		TargetType: logs.TargetUser,
+		TargetID:   uid,
+		Before:     gin.H{"two_factor": false},
+		After:      gin.H{"two_factor": true},
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Two-factor authentication enabled",
+		"recovery_codes": codes,
+	})
+}
+
+func (ac *AuthController) DisableTwoFactor(c *gin.Context) {
+	user, ok := ac.currentUser(c)
+	if !ok {
+		return
+	}
+
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := ac.AuthService.VerifyTOTP(user.ID, req.Code); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := ac.AuthService.DisableTOTP(user); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	uid := uint(user.ID)
+
+	ac.LS.Record(c, logs.Event{
+		Level:      logs.LevelWarn,
+		Service:    "auth",
+		Action:     logs.ActionDisableTwoFactor,
+		Message:    fmt.Sprintf("Two-factor authentication disabled for %s", user.Email),
+		UserID:     &uid,
+		TargetType: logs.TargetUser,
+		TargetID:   uid,
+		Before:     gin.H{"two_factor": true},
+		After:      gin.H{"two_factor": false},
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+func (ac *AuthController) RegenerateRecoveryCodes(c *gin.Context) {
+	user, ok := ac.currentUser(c)
+	if !ok {
+		return
+	}
+
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := ac.AuthService.VerifyTOTP(user.ID, req.Code); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	codes, err := ac.AuthService.RegenerateRecoveryCodes(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	uid := uint(user.ID)
+
+	ac.LS.Record(c, logs.Event{
+		Service:    "auth",
+		Action:     logs.ActionRegenerateRecoveryCodes,
+		Message:    fmt.Sprintf("Recovery codes regenerated for %s", user.Email),
+		UserID:     &uid,
+		TargetType: logs.TargetUser,
+		TargetID:   uid,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Recovery codes regenerated",
+		"recovery_codes": codes,
+	})
+}
+
+// GET /api/user/oidc/providers
+func (ac *AuthController) GetOIDCProviders(c *gin.Context) {
+	names := make([]string, 0, len(ac.AuthService.OIDC))
+	for name := range ac.AuthService.OIDC {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	c.JSON(http.StatusOK, gin.H{"providers": names})
+}
+
+// GET /api/user/oidc/:provider/login
+func (ac *AuthController) OIDCLogin(c *gin.Context) {
+	provider, ok := ac.AuthService.OIDC[c.Param("provider")]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown sign-in provider"})
+		return
+	}
+
+	state, stateCookie, err := ac.AuthService.NewOIDCState(provider.Name(), c.Query("remember_me") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	authURL, err := provider.AuthCodeURL(c.Request.Context(), state.State, state.Nonce, state.Verifier)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "sign-in provider is unavailable"})
+		return
+	}
+
+	setOIDCStateCookie(c, stateCookie, int(oidcStateTTL.Seconds()))
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// GET /api/user/oidc/:provider/callback
+//
+// The browser arrives here from the provider, so every outcome is a redirect
+// back to the frontend rather than a JSON body.
+func (ac *AuthController) OIDCCallback(c *gin.Context) {
+	name := c.Param("provider")
+	provider, ok := ac.AuthService.OIDC[name]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown sign-in provider"})
+		return
+	}
+
+	stateCookie, _ := c.Cookie(oidcStateCookie)
+	setOIDCStateCookie(c, "", -1)
+
+	if e := c.Query("error"); e != "" {
+		ac.oidcFailed(c, name, nil, "sign-in was cancelled or denied", e)
+		return
+	}
+
+	state, err := ac.AuthService.ParseOIDCState(stateCookie, name, c.Query("state"))
+	if err != nil {
+		ac.oidcFailed(c, name, nil, "sign-in expired, please try again", err.Error())
+		return
+	}
+
+	rawIDToken, err := provider.Exchange(c.Request.Context(), c.Query("code"), state.Verifier)
+	if err != nil {
+		ac.oidcFailed(c, name, nil, "sign-in failed", err.Error())
+		return
+	}
+
+	claims, err := provider.VerifyIDToken(c.Request.Context(), rawIDToken, state.Nonce)
+	if err != nil {
+		ac.oidcFailed(c, name, nil, "sign-in failed", err.Error())
+		return
+	}
+
+	user, created, err := ac.AuthService.ResolveOIDCUser(name, claims)
+	if err != nil {
+		message := "sign-in failed"
+		if errors.Is(err, ErrSSOEmailUnverified) || errors.Is(err, ErrSSONoAccount) {
+			message = err.Error()
+		}
+		ac.oidcFailed(c, name, nil, message, err.Error())
+		return
+	}
+
+	uid := uint(user.ID)
+
+	if created {
+		ac.LS.Record(c, logs.Event{
+			Service:    "auth",
+			Action:     logs.ActionSSOProvision,
+			Message:    fmt.Sprintf("Account created through %s for %s", name, user.Email),
+			UserID:     &uid,
+			TargetType: logs.TargetUser,
+			TargetID:   uid,
+			Metadata:   gin.H{"provider": name, "role": user.Role},
+		})
+	}
+
+	if user.DisabledAt != nil {
+		ac.oidcFailed(c, name, &uid, ErrAccountDisabled.Error(), "account disabled")
+		return
+	}
+
+	// Local two-factor policy still applies on top of the provider's
+	enabled, err := ac.AuthService.TwoFactorEnabled(user.ID)
+	if err != nil {
+		ac.oidcFailed(c, name, &uid, "sign-in failed", err.Error())
+		return
+	}
+	purpose := ""
+	if enabled {
+		purpose = challengeTwoFactor
+	} else if required, err := ac.AuthService.TwoFactorRequired(user); err != nil {
+		ac.oidcFailed(c, name, &uid, "sign-in failed", err.Error())
+		return
+	} else if required {
+		purpose = challengeSetup
+	}
+
+	if purpose != "" {
+		challenge, err := ac.AuthService.SignLoginChallenge(user.ID, purpose, state.RememberMe)
+		if err != nil {
+			ac.oidcFailed(c, name, &uid, "sign-in failed", err.Error())
+			return
+		}
+		ac.oidcRedirect(c, "/login", url.Values{"challenge": {challenge}, "purpose": {purpose}})
+		return
+	}
+
+	if err := ac.startSession(c, user, state.RememberMe, name); err != nil {
+		ac.oidcFailed(c, name, &uid, "sign-in failed", err.Error())
+		return
+	}
+
+	ac.oidcRedirect(c, "/", nil)
+}
+
+func (ac *AuthController) oidcFailed(c *gin.Context, provider string, userID *uint, message, reason string) {
+	ac.LS.Record(c, logs.Event{
+		Level:    logs.LevelWarn,
+		Service:  "auth",
+		Action:   logs.ActionSSOLoginFailed,
+		Message:  fmt.Sprintf("Single sign-on through %s failed: %s", provider, reason),
+		UserID:   userID,
+		Metadata: gin.H{"provider": provider},
+	})
+	ac.oidcRedirect(c, "/login", url.Values{"sso_error": {message}})
+}
+
+func (ac *AuthController) oidcRedirect(c *gin.Context, path string, q url.Values) {
+	target := strings.TrimRight(ac.AuthService.CFG.AppURL, "/") + path
+	if len(q) > 0 {
+		target += "?" + q.Encode()
+	}
+	c.Redirect(http.StatusFound, target)
+}
+
+const oidcStateCookie = "oidc_state"
+
+// setOIDCStateCookie uses SameSite=Lax so the cookie comes back on the
+// top-level redirect from the provider
+func setOIDCStateCookie(c *gin.Context, value string, maxAge int) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    value,
+		Path:     "/api/user/oidc",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// GET /api/user/tokens
+func (ac *AuthController) GetAccessTokens(c *gin.Context) {
+	user, ok := ac.currentUser(c)
+	if !ok {
+		return
+	}
+
+	tokens, err := ac.AuthService.GetAccessTokens(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tokens": tokens, "available_scopes": middlewares.Scopes})
+}
+
+// POST /api/user/tokens
+func (ac *AuthController) CreateAccessToken(c *gin.Context) {
+	user, ok := ac.currentUser(c)
+	if !ok {
+		return
+	}
+
+	var input AccessTokenInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	token, raw, err := ac.AuthService.CreateAccessToken(user.ID, input)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	uid := uint(user.ID)
+
+	ac.LS.Record(c, logs.Event{
+		Service:    "auth",
+		Action:     logs.ActionCreateAccessToken,
+		Message:    fmt.Sprintf("Access token %q created", token.Name),
+		UserID:     &uid,
+		TargetType: logs.TargetAccessToken,
+		TargetID:   token.ID,
+		After:      gin.H{"scopes": token.Scopes, "expires_at": token.ExpiresAt},
+	})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Copy the token now, it won't be shown again",
+		"token":   raw,
+		"data":    token,
+	})
+}
+
+// DELETE /api/user/tokens/:id
+func (ac *AuthController) RevokeAccessToken(c *gin.Context) {
+	user, ok := ac.currentUser(c)
+	if !ok {
+		return
+	}
+
+	token, err := ac.AuthService.RevokeAccessToken(user.ID, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	uid := uint(user.ID)
+
+	ac.LS.Record(c, logs.Event{
+		Level:      logs.LevelWarn,
+		Service:    "auth",
+		Action:     logs.ActionRevokeAccessToken,
+		Message:    fmt.Sprintf("Access token %q revoked", token.Name),
+		UserID:     &uid,
+		TargetType: logs.TargetAccessToken,
+		TargetID:   token.ID,
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Access token revoked"})
+}
+
+// GET /.well-known/jwks.json
+func (ac *AuthController) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, ac.AuthService.Keys.JWKS())
+}
+
+// POST /api/user/verify-email
+func (ac *AuthController) VerifyEmail(c *gin.Context) {
+	var req VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := ac.AuthService.VerifyEmail(req.Token)
+	if err != nil {
+		if errors.Is(err, ErrInvalidVerification) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	uid := uint(user.ID)
+
+	ac.LS.Record(c, logs.Event{
+		Service:    "auth",
+		Action:     logs.ActionVerifyEmail,
+		Message:    fmt.Sprintf("Email verified for %s", user.Email),
+		UserID:     &uid,
+		TargetType: logs.TargetUser,
+		TargetID:   uid,
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified, you can now log in"})
+}
+
+// POST /api/user/:id/verification/resend
+func (ac *AuthController) ResendVerification(c *gin.Context) {
+	admin, ok := ac.requireAdmin(c)
+	if !ok {
+		return
+	}
+
+	target, ok := ac.targetUser(c)
+	if !ok {
+		return
+	}
+
+	if err := ac.AuthService.SendSignupConfirmation(target); err != nil {
+		if errors.Is(err, ErrEmailAlreadyVerified) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	uid := uint(admin.ID)
+
+	ac.LS.Record(c, logs.Event{
+		Service:    "auth",
+		Action:     logs.ActionResendVerification,
+		Message:    fmt.Sprintf("Verification email resent to %s", target.Email),
+		UserID:     &uid,
+		TargetType: logs.TargetUser,
+		TargetID:   uint(target.ID),
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Verification email sent"})
+}
+
+// POST /api/user/:id/verify
+func (ac *AuthController) AdminVerifyEmail(c *gin.Context) {
+	admin, ok := ac.requireAdmin(c)
+	if !ok {
+		return
+	}
+
+	target, ok := ac.targetUser(c)
+	if !ok {
+		return
+	}
+
+	if target.EmailVerifiedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": ErrEmailAlreadyVerified.Error()})
+		return
+	}
+
+	if err := ac.AuthService.MarkEmailVerified(target); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	uid := uint(admin.ID)
+
+	ac.LS.Record(c, logs.Event{
+		Level:      logs.LevelWarn,
+		Service:    "auth",
+		Action:     logs.ActionAdminVerifyEmail,
+		Message:    fmt.Sprintf("Email of %s verified by admin", target.Email),
+		UserID:     &uid,
+		TargetType: logs.TargetUser,
+		TargetID:   uint(target.ID),
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified"})
+}
+
+// GET /api/user/all
+func (ac *AuthController) ListUsers(c *gin.Context) {
+	if _, ok := ac.requireAdmin(c); !ok {
+		return
+	}
+
+	var input UserListInput
+	if err := c.ShouldBindQuery(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	users, total, totalPages, err := ac.AuthService.ListUsers(&input)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":        users,
+		"page":        input.Page,
+		"page_size":   input.PageSize,
+		"total":       total,
+		"total_pages": totalPages,
+	})
+}
+
+// PUT /api/user/:id/role
+func (ac *AuthController) UpdateUserRole(c *gin.Context) {
+	admin, target, ok := ac.adminTarget(c)
+	if !ok {
+		return
+	}
+
+	var input UserRoleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	previous := target.Role
+	if err := ac.AuthService.SetUserRole(target, input.Role); err != nil {
+		ac.userActionError(c, err)
+		return
+	}
+
+	ac.logUserAction(c, admin, target, logs.ActionChangeUserRole, fmt.Sprintf("Role of %s changed from %s to %s", target.Email, previous, target.Role), gin.H{"role": previous}, gin.H{"role": target.Role})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Role updated", "user": target})
+}
+
+// POST /api/user/:id/disable
+func (ac *AuthController) DisableUser(c *gin.Context) {
+	ac.setUserDisabled(c, true)
+}
+
+// POST /api/user/:id/enable
+func (ac *AuthController) EnableUser(c *gin.Context) {
+	ac.setUserDisabled(c, false)
+}
+
+func (ac *AuthController) setUserDisabled(c *gin.Context, disabled bool) {
+	admin, target, ok := ac.adminTarget(c)
+	if !ok {
+		return
+	}
+
+	if err := ac.AuthService.SetUserDisabled(target, disabled); err != nil {
+		ac.userActionError(c, err)
+		return
+	}
+
+	if disabled {
+		ac.logUserAction(c, admin, target, logs.ActionDisableUser, fmt.Sprintf("Account %s disabled", target.Email), gin.H{"disabled": false}, gin.H{"disabled": true})
+		c.JSON(http.StatusOK, gin.H{"message": "User disabled", "user": target})
+		return
+	}
+
+	ac.logUserAction(c, admin, target, logs.ActionEnableUser, fmt.Sprintf("Account %s enabled", target.Email), gin.H{"disabled": true}, gin.H{"disabled": false})
+	c.JSON(http.StatusOK, gin.H{"message": "User enabled", "user": target})
+}
+
+// POST /api/user/:id/force-password-reset
+func (ac *AuthController) ForcePasswordReset(c *gin.Context) {
+	admin, target, ok := ac.adminTarget(c)
+	if !ok {
+		return
+	}
+
+	err := ac.AuthService.ForcePasswordReset(target)
+	if err != nil && !errors.Is(err, ErrResetMailFailed) {
+		ac.userActionError(c, err)
+		return
+	}
+
+	ac.logUserAction(c, admin, target, logs.ActionForcePasswordReset, fmt.Sprintf("Password reset forced for %s", target.Email), nil, gin.H{"password_reset_required": true})
 
-	if err := ac.LS.Log("INFO", "auth", "SIGNUP", fmt.Sprintf("Account created with email %s", user.Email), &uid, user); err != nil {
-		fmt.Printf("Failed to insert log: %v\n", err)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{
-		"message": "User created successfully",
-		"user": map[string]interface{}{
-			"id":        newuser.ID,
-			"firstname": newuser.FirstName,
-			"lastname":  newuser.LastName,
-			"email":     newuser.Email,
-		},
-	})
-}
-
-type LoginRequest struct {
-	Email      string `json:"email" binding:"required,email"`
-	Password   string `json:"password" binding:"required"`
-	RememberMe bool   `json:"rememberMe"`
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset required, a reset code was emailed to the user"})
 }
 
-func (ac *AuthController) Login(c *gin.Context) {
-	var req LoginRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+// DELETE /api/user/:id?mode=delete|anonymise
+func (ac *AuthController) DeleteUser(c *gin.Context) {
+	admin, target, ok := ac.adminTarget(c)
+	if !ok {
 		return
 	}
 
-	user, err := ac.AuthService.GetUser(req.Email)
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Oops! We couldn’t log you in. Please check your username and password and try again."})
-		return
+	email := target.Email
+
+	switch mode := c.DefaultQuery("mode", "delete"); mode {
+	case "delete":
+		if err := ac.AuthService.DeleteUser(target); err != nil {
+			ac.userActionError(c, err)
+			return
+		}
+		ac.logUserAction(c, admin, target, logs.ActionDeleteUser, fmt.Sprintf("Account %s deleted", email), gin.H{"email": email, "role": target.Role}, nil)
+		c.JSON(http.StatusOK, gin.H{"message": "User deleted"})
+	case "anonymise":
+		if err := ac.AuthService.AnonymiseUser(target); err != nil {
+			ac.userActionError(c, err)
+			return
+		}
+		ac.logUserAction(c, admin, target, logs.ActionAnonymiseUser, fmt.Sprintf("Account %d anonymised", target.ID), nil, nil)
+		c.JSON(http.StatusOK, gin.H{"message": "User anonymised"})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mode must be delete or anonymise"})
 	}
+}
 
-	if err := util.VerifyPassword(req.Password, user.Password); err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Oops! We couldn’t log you in. Please check your username and password and try again."})
-		return
+// adminTarget combines requireAdmin and targetUser, and stops admins from
+// acting on their own account. It writes the error response itself.
+func (ac *AuthController) adminTarget(c *gin.Context) (*Auth, *Auth, bool) {
+	admin, ok := ac.requireAdmin(c)
+	if !ok {
+		return nil, nil, false
 	}
 
-	cfg := config.LoadConfig()
+	target, ok := ac.targetUser(c)
+	if !ok {
+		return nil, nil, false
+	}
 
-	// Short-lived access token
-	accessExp := time.Now().Add(15 * time.Minute)
-	accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id": user.ID,
-		"exp":     accessExp.Unix(),
-	})
-	accessTokenString, _ := accessToken.SignedString([]byte(cfg.JWTSecret))
+	if target.ID == admin.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "you can't do this to your own account"})
+		return nil, nil, false
+	}
+	return admin, target, true
+}
 
-	// Refresh token (longer if RememberMe is true)
-	refreshDuration := 24 * time.Hour
-	if req.RememberMe {
-		refreshDuration = 30 * 24 * time.Hour
+func (ac *AuthController) userActionError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrLastAdmin), errors.Is(err, ErrUserOwnsData):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrUnknownRole):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 	}
-	refreshExp := time.Now().Add(refreshDuration)
-	refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id": user.ID,
-		"exp":     refreshExp.Unix(),
+}
+
+func (ac *AuthController) logUserAction(c *gin.Context, admin, target *Auth, action logs.Action, message string, before, after gin.H) {
+	uid := uint(admin.ID)
+
+	ac.LS.Record(c, logs.Event{
+		Level:      logs.LevelWarn,
+		Service:    "auth",
+		Action:     action,
+		Message:    message,
+		UserID:     &uid,
+		TargetType: logs.TargetUser,
+		TargetID:   uint(target.ID),
+		Before:     before,
+		After:      after,
 	})
-	refreshTokenString, _ := refreshToken.SignedString([]byte(cfg.JWTSecret))
+}
 
-	httpOnly := true
-	secure := true // Must be true for HTTPS
-	accessCookie := &http.Cookie{
-		Name:     "access_token",
-		Value:    accessTokenString,
-		Path:     "/",
-		HttpOnly: httpOnly,
-		Secure:   secure,
-		SameSite: http.SameSiteNoneMode, // required for cross-site cookies
+// requireAdmin loads the caller and writes the error response itself unless
+// they are an admin
+func (ac *AuthController) requireAdmin(c *gin.Context) (*Auth, bool) {
+	user, ok := ac.currentUser(c)
+	if !ok {
+		return nil, false
 	}
-	refreshCookie := &http.Cookie{
-		Name:     "refresh_token",
-		Value:    refreshTokenString,
-		Path:     "/",
-		HttpOnly: httpOnly,
-		Secure:   secure,
-		SameSite: http.SameSiteNoneMode,
+	if user.Role != "Admin" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only admins can manage users"})
+		return nil, false
 	}
-	http.SetCookie(c.Writer, accessCookie)
-	http.SetCookie(c.Writer, refreshCookie)
-
-	uid := uint(user.ID)
+	return user, true
+}
 
-	if err := ac.LS.Log("INFO", "auth", "LOGIN", fmt.Sprintf("User logged in with email: %s", user.Email), &uid, req); err != nil {
-		fmt.Printf("Failed to insert log: %v\n", err)
+// targetUser loads the user named by the :id path parameter and writes the
+// error response itself if there is none
+func (ac *AuthController) targetUser(c *gin.Context) (*Auth, bool) {
+	targetID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return nil, false
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Login successful",
-		"data": LoginResponse{
-			ID:        user.ID,
-			FirstName: user.FirstName,
-			LastName:  user.LastName,
-			Email:     user.Email,
-			Role:      user.Role,
-		},
-	})
+	target, err := ac.AuthService.GetUserByID(targetID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return nil, false
+	}
+	return target, true
 }
 
-func (ac *AuthController) Logout(c *gin.Context) {
-	accessCookie := &http.Cookie{
-		Name:     "access_token",
-		Value:    "",
-		Path:     "/",
-		HttpOnly: true,
-		Secure:   true,
-		SameSite: http.SameSiteNoneMode,
-		MaxAge:   -1,
+// currentUser loads the authenticated user, writing the error response itself on failure
+func (ac *AuthController) currentUser(c *gin.Context) (*Auth, bool) {
+	userIDVal, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user ID not found"})
+		return nil, false
 	}
-	refreshCookie := &http.Cookie{
-		Name:     "refresh_token",
-		Value:    "",
-		Path:     "/",
-		HttpOnly: true,
-		Secure:   true,
-		SameSite: http.SameSiteNoneMode,
-		MaxAge:   -1,
+
+	userID, ok := userIDVal.(float64)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user ID"})
+		return nil, false
 	}
-	http.SetCookie(c.Writer, accessCookie)
-	http.SetCookie(c.Writer, refreshCookie)
 
-	c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+	user, err := ac.AuthService.GetUserByID(int(userID))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return nil, false
+	}
+
+	return user, true
 }
 
 func (ac *AuthController) Me(c *gin.Context) {
-	cfg := config.LoadConfig()
-
 	accessToken, err := c.Cookie("access_token")
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing access token"})
 		return
 	}
 
-	token, err := jwt.Parse(accessToken, func(token *jwt.Token) (interface{}, error) {
-		return []byte(cfg.JWTSecret), nil
-	})
-
-	if err != nil || !token.Valid {
+	claims, err := ac.AuthService.Keys.Parse(accessToken)
+	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
 		return
 	}
 
-	claims := token.Claims.(jwt.MapClaims)
+	if _, isChallenge := claims["purpose"]; isChallenge {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+		return
+	}
 	userID := int(claims["user_id"].(float64))
 
 	user, err := ac.AuthService.GetUserByID(userID)
@@ -216,48 +1448,42 @@ func (ac *AuthController) Me(c *gin.Context) {
 	})
 }
 
-// Refresh endpoint to generate new access token
+// Refresh endpoint to rotate the refresh token and generate a new access token
 func (ac *AuthController) Refresh(c *gin.Context) {
-	cfg := config.LoadConfig()
-
 	refreshToken, err := c.Cookie("refresh_token")
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing refresh token"})
 		return
 	}
 
-	token, err := jwt.Parse(refreshToken, func(token *jwt.Token) (interface{}, error) {
-		return []byte(cfg.JWTSecret), nil
-	})
-
-	if err != nil || !token.Valid {
+	session, newRefreshToken, err := ac.AuthService.RotateRefreshToken(refreshToken, c.Request.UserAgent(), c.ClientIP())
+	if errors.Is(err, ErrRefreshTokenReuse) {
+		uid := uint(session.UserID)
+		ac.LS.Record(c, logs.Event{
+			Level:      logs.LevelWarn,
+			Service:    "auth",
+			Action:     logs.ActionRefreshTokenReuse,
+			Message:    fmt.Sprintf("Refresh token reused, session %d revoked", session.ID),
+			UserID:     &uid,
+			TargetType: logs.TargetSession,
+			TargetID:   session.ID,
+		})
+		clearAuthCookies(c)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
 		return
 	}
 
-	claims := token.Claims.(jwt.MapClaims)
-	userID := int(claims["user_id"].(float64))
-
-	// Generate new access token
-	accessExp := time.Now().Add(15 * time.Minute)
-	accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id": userID,
-		"exp":     accessExp.Unix(),
-	})
-	accessTokenString, _ := accessToken.SignedString([]byte(cfg.JWTSecret))
-
-	httpOnly := true
-	secure := true // Must be true for HTTPS
-	accessCookie := &http.Cookie{
-		Name:     "access_token",
-		Value:    accessTokenString,
-		Path:     "/",
-		HttpOnly: httpOnly,
-		Secure:   secure,
-		SameSite: http.SameSiteNoneMode, // required for cross-site cookies
+	accessToken, err := ac.AuthService.SignAccessToken(session.UserID, session.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
-	http.SetCookie(c.Writer, accessCookie)
+	setAuthCookies(c, accessToken, newRefreshToken)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Access token refreshed"})
 }
@@ -313,17 +1539,33 @@ func (ac *AuthController) VerifyPassword(c *gin.Context) {
 		return
 	}
 
+	uid := uint(user.ID)
+
+	accountKey := AccountThrottleKey("verify-password", strconv.Itoa(user.ID))
+	ipKey := IPThrottleKey("verify-password", c.ClientIP())
+	if ac.throttled(c, accountKey, ipKey) {
+		return
+	}
+
 	if err := util.VerifyPassword(req.Password, user.Password); err != nil {
+		ac.recordFailure(c, &uid, accountKey, ipKey)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid credentials"})
 		return
 	}
 
-	uid := uint(user.ID)
-
-	if err := ac.LS.Log("INFO", "auth", "PASSWORD_VERIFICATION", fmt.Sprintf("Verified password for file access by : %s", user.Email), &uid, req); err != nil {
-		fmt.Printf("Failed to insert log: %v\n", err)
+	if err := ac.AuthService.ResetThrottle(accountKey); err != nil {
+		fmt.Printf("Failed to reset password verification throttle: %v\n", err)
 	}
 
+	ac.LS.Record(c, logs.Event{
+		Service:    "auth",
+		Action:     logs.ActionPasswordVerification,
+		Message:    fmt.Sprintf("Verified password for file access by : %s", user.Email),
+		UserID:     &uid,
+		TargetType: logs.TargetUser,
+		TargetID:   uid,
+	})
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Password verified successfully",
 		"data": VerifyPasswordResponse{
@@ -339,12 +1581,10 @@ func (ac *AuthController) SendOTP(c *gin.Context) {
 		return
 	}
 
-	if _, err := ac.AuthService.SendOTP(req.Email); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
+	// The response is the same whether or not the account exists
+	ac.AuthService.SendOTP(req.Email)
 
-	c.JSON(http.StatusOK, gin.H{"message": "OTP sent successfully"})
+	c.JSON(http.StatusOK, gin.H{"message": "If an account exists for this email, an OTP has been sent"})
 }
 
 // POST /api/user/reset-password
@@ -355,14 +1595,158 @@ func (ac *AuthController) ResetPassword(c *gin.Context) {
 		return
 	}
 
+	accountKey := AccountThrottleKey("reset-password", req.Email)
+	ipKey := IPThrottleKey("reset-password", c.ClientIP())
+	if ac.throttled(c, accountKey, ipKey) {
+		return
+	}
+
 	if err := ac.AuthService.ResetPassword(req.Email, req.OTP, req.Password); err != nil {
+		// a rejected password comes after a correct code and is not a failed guess
+		if !isPasswordRejected(err) {
+			ac.recordFailure(c, nil, accountKey, ipKey)
+		}
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	if err := ac.AuthService.ResetThrottle(accountKey); err != nil {
+		fmt.Printf("Failed to reset password reset throttle: %v\n", err)
+	}
+
+	if user, err := ac.AuthService.GetUser(req.Email); err == nil {
+		uid := uint(user.ID)
+		ac.LS.Record(c, logs.Event{
+			Level:      logs.LevelWarn,
+			Service:    "auth",
+			Action:     logs.ActionResetPassword,
+			Message:    fmt.Sprintf("Password reset for %s", user.Email),
+			UserID:     &uid,
+			TargetType: logs.TargetUser,
+			TargetID:   uid,
+		})
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "Password reset successfully"})
 }
 
+// POST /api/user/change-password
+func (ac *AuthController) ChangePassword(c *gin.Context) {
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userIDVal, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user ID not found"})
+		return
+	}
+
+	userID, ok := userIDVal.(float64)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user ID"})
+		return
+	}
+
+	user, err := ac.AuthService.GetUserByID(int(userID))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		return
+	}
+
+	uid := uint(user.ID)
+
+	accountKey := AccountThrottleKey("change-password", strconv.Itoa(user.ID))
+	ipKey := IPThrottleKey("change-password", c.ClientIP())
+	if ac.throttled(c, accountKey, ipKey) {
+		return
+	}
+
+	if err := util.VerifyPassword(req.CurrentPassword, user.Password); err != nil {
+		ac.recordFailure(c, &uid, accountKey, ipKey)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Current password is incorrect"})
+		return
+	}
+
+	if err := ac.AuthService.ResetThrottle(accountKey); err != nil {
+		fmt.Printf("Failed to reset password change throttle: %v\n", err)
+	}
+
+	sessionID := c.GetUint("sessionID")
+	revoked, err := ac.AuthService.ChangePassword(user, req.NewPassword, sessionID)
+	if err != nil {
+		if isPasswordRejected(err) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ac.LS.Record(c, logs.Event{
+		Level:      logs.LevelWarn,
+		Service:    "auth",
+		Action:     logs.ActionChangePassword,
+		Message:    fmt.Sprintf("Password changed, signed out of %d other sessions", revoked),
+		UserID:     &uid,
+		TargetType: logs.TargetUser,
+		TargetID:   uid,
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed successfully", "revoked": revoked})
+}
+
+// GET /api/user/password-policy
+func (ac *AuthController) GetPasswordPolicy(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"policy": ac.AuthService.Passwords})
+}
+
+// isPasswordRejected reports whether err is the policy or history refusing a
+// new password rather than a failure
+func isPasswordRejected(err error) bool {
+	var policyErr *password.PolicyError
+	return errors.As(err, &policyErr) || errors.Is(err, ErrPasswordReused)
+}
+
+// throttled writes a 429 response and returns true while any of the keys is locked
+func (ac *AuthController) throttled(c *gin.Context, keys ...string) bool {
+	err := ac.AuthService.CheckThrottle(keys...)
+
+	var locked *ThrottleLockedError
+	if errors.As(err, &locked) {
+		c.Header("Retry-After", strconv.Itoa(int(locked.RetryAfter.Seconds())+1))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": locked.Error()})
+		return true
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return true
+	}
+	return false
+}
+
+// recordFailure counts a failed attempt and writes a WARN log for every lockout it causes
+func (ac *AuthController) recordFailure(c *gin.Context, userID *uint, keys ...string) {
+	lockouts, err := ac.AuthService.RecordFailure(keys...)
+	if err != nil {
+		fmt.Printf("Failed to record failed attempt: %v\n", err)
+	}
+
+	for _, l := range lockouts {
+		message := fmt.Sprintf("Locked %s until %s", l.Key, l.Until.Format(time.RFC3339))
+		ac.LS.Record(c, logs.Event{
+			Level:    logs.LevelWarn,
+			Service:  "auth",
+			Action:   logs.ActionLockout,
+			Message:  message,
+			UserID:   userID,
+			Metadata: gin.H{"key": l.Key, "locked_until": l.Until},
+		})
+	}
+}
+
 // func (ac *AuthController) GetAllRequests(c *gin.Context) {
 // 	userIDVal, exists := c.Get("userID")
 // 	if !exists {
@@ -421,3 +1805,49 @@ func (ac *AuthController) ResetPassword(c *gin.Context) {
 
 // 	c.JSON(http.StatusOK, gin.H{"message": "Requests processed successfully"})
 // }
+
+func setAuthCookies(c *gin.Context, accessToken, refreshToken string) {
+	httpOnly := true
+	secure := true // Must be true for HTTPS
+	accessCookie := &http.Cookie{
+		Name:     "access_token",
+		Value:    accessToken,
+		Path:     "/",
+		HttpOnly: httpOnly,
+		Secure:   secure,
+		SameSite: http.SameSiteNoneMode, // required for cross-site cookies
+	}
+	refreshCookie := &http.Cookie{
+		Name:     "refresh_token",
+		Value:    refreshToken,
+		Path:     "/",
+		HttpOnly: httpOnly,
+		Secure:   secure,
+		SameSite: http.SameSiteNoneMode,
+	}
+	http.SetCookie(c.Writer, accessCookie)
+	http.SetCookie(c.Writer, refreshCookie)
+}
+
+func clearAuthCookies(c *gin.Context) {
+	accessCookie := &http.Cookie{
+		Name:     "access_token",
+		Value:    "",
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteNoneMode,
+		MaxAge:   -1,
+	}
+	refreshCookie := &http.Cookie{
+		Name:     "refresh_token",
+		Value:    "",
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteNoneMode,
+		MaxAge:   -1,
+	}
+	http.SetCookie(c.Writer, accessCookie)
+	http.SetCookie(c.Writer, refreshCookie)
+}
@@ -2,6 +2,8 @@ package auth
 
 import (
 	"time"
+
+	"gorm.io/datatypes"
 )
 
 type Auth struct {
@@ -13,6 +15,12 @@ type Auth struct {
 	Role      string    `json:"role"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+	// EmailVerifiedAt is nil until the user opens the link sent at signup
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	// DisabledAt blocks login and every existing token while set
+	DisabledAt *time.Time `json:"disabled_at"`
+	// PasswordResetRequired blocks login until the user resets their password
+	PasswordResetRequired bool `gorm:"not null;default:false" json:"password_reset_required"`
 }
 
 type Access struct {
@@ -24,13 +32,14 @@ type Access struct {
 }
 
 type Role struct {
-	ID            uint   `gorm:"primaryKey;autoIncrement" json:"id"`
-	Role          string `gorm:"size:100;not null;unique" json:"role"`
-	Priority      int    `gorm:"not null" json:"priority"`
-	CanUpload     bool   `gorm:"not null" json:"can_upload"`
-	CanView       bool   `gorm:"not null" json:"can_view"`
-	CanApprove    bool   `gorm:"not null" json:"can_approve"`
-	CanApproveAll bool   `gorm:"not null" json:"can_approve_all"`
+	ID               uint   `gorm:"primaryKey;autoIncrement" json:"id"`
+	Role             string `gorm:"size:100;not null;unique" json:"role"`
+	Priority         int    `gorm:"not null" json:"priority"`
+	CanUpload        bool   `gorm:"not null" json:"can_upload"`
+	CanView          bool   `gorm:"not null" json:"can_view"`
+	CanApprove       bool   `gorm:"not null" json:"can_approve"`
+	CanApproveAll    bool   `gorm:"not null" json:"can_approve_all"`
+	RequireTwoFactor bool   `gorm:"not null;default:false" json:"require_two_factor"`
 }
 
 type RequestAction struct {
@@ -70,24 +79,198 @@ type SendOTPRequest struct {
 type ResetPasswordRequest struct {
 	Email    string `json:"email" binding:"required,email"`
 	OTP      string `json:"otp" binding:"required"`
-	Password string `json:"password" binding:"required,min=6"`
+	Password string `json:"password" binding:"required"`
+}
+
+type UserListInput struct {
+	Page     int    `form:"page"`
+	PageSize int    `form:"page_size"`
+	Search   string `form:"search"`
+	Role     string `form:"role"`
+	Status   string `form:"status"` // active, disabled or unverified
+}
+
+type UserRoleInput struct {
+	Role string `json:"role" binding:"required"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
 }
 
 type VerifyPasswordRequest struct {
 	Password string `json:"password"`
 }
 
+// OTP is a password reset code. Only its keyed hash is stored and it can be
+// used once; issuing a new code invalidates the earlier ones.
 type OTP struct {
-	ID        uint      `gorm:"primaryKey"`
-	Email     string    `gorm:"index;not null"`
-	Code      string    `gorm:"size:6;not null"`
+	ID        uint   `gorm:"primaryKey"`
+	Email     string `gorm:"index;not null"`
+	CodeHash  string `gorm:"size:64;not null"`
+	Attempts  int    `gorm:"not null;default:0"`
+	UsedAt    *time.Time
 	CreatedAt time.Time `gorm:"autoCreateTime"`
 }
 
+// Session is one signed-in device. Every refresh token issued for it belongs
+// to the same family, so reuse of a rotated token revokes the whole session.
+type Session struct {
+	ID            uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID        int        `gorm:"not null;index" json:"user_id"`
+	UserAgent     string     `gorm:"type:text" json:"user_agent"`
+	IPAddress     string     `gorm:"size:64" json:"ip_address"`
+	RememberMe    bool       `gorm:"not null;default:false" json:"remember_me"`
+	CreatedAt     time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	LastUsedAt    time.Time  `json:"last_used_at"`
+	ExpiresAt     time.Time  `gorm:"not null" json:"expires_at"`
+	RevokedAt     *time.Time `json:"revoked_at,omitempty"`
+	RevokedReason string     `gorm:"size:255" json:"revoked_reason,omitempty"`
+}
+
+type SessionResponse struct {
+	ID         uint      `json:"id"`
+	UserAgent  string    `json:"device"`
+	IPAddress  string    `json:"ip_address"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
+
+type RefreshToken struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement"`
+	SessionID uint      `gorm:"not null;index"`
+	TokenHash string    `gorm:"size:64;not null;uniqueIndex"`
+	ExpiresAt time.Time `gorm:"not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+// UserTOTP holds the encrypted authenticator secret of a user. It is only
+// enforced at login once EnabledAt is set.
+type UserTOTP struct {
+	UserID       int        `gorm:"primaryKey" json:"user_id"`
+	Secret       string     `gorm:"not null" json:"-"`
+	EnabledAt    *time.Time `json:"enabled_at,omitempty"`
+	LastUsedStep int64      `gorm:"not null;default:0" json:"-"`
+	CreatedAt    time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+type RecoveryCode struct {
+	ID        uint   `gorm:"primaryKey;autoIncrement"`
+	UserID    int    `gorm:"not null;index"`
+	CodeHash  string `gorm:"size:64;not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+// PasswordHistory keeps the hashes of replaced passwords so they can't be
+// reused
+type PasswordHistory struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement"`
+	UserID    int       `gorm:"not null;index"`
+	Password  string    `gorm:"not null"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type TwoFactorLoginRequest struct {
+	Challenge    string `json:"challenge" binding:"required"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+type TwoFactorSetupResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+// UserIdentity links an account at an external OIDC provider to a user
+type UserIdentity struct {
+	ID          uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID      int        `gorm:"not null;index" json:"user_id"`
+	Provider    string     `gorm:"size:50;not null;uniqueIndex:idx_identity_subject" json:"provider"`
+	Subject     string     `gorm:"size:255;not null;uniqueIndex:idx_identity_subject" json:"subject"`
+	Email       string     `gorm:"size:100" json:"email"`
+	CreatedAt   time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+}
+
+// PersonalAccessToken lets scripts call the API with "Authorization: Bearer".
+// Only the hash is stored; the token is shown once when created.
+type PersonalAccessToken struct {
+	ID         uint                        `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID     int                         `gorm:"not null;index" json:"user_id"`
+	Name       string                      `gorm:"size:100;not null" json:"name"`
+	Prefix     string                      `gorm:"size:16;not null" json:"prefix"`
+	TokenHash  string                      `gorm:"size:64;not null;uniqueIndex" json:"-"`
+	Scopes     datatypes.JSONSlice[string] `gorm:"type:jsonb" json:"scopes"`
+	ExpiresAt  time.Time                   `gorm:"not null" json:"expires_at"`
+	LastUsedAt *time.Time                  `json:"last_used_at,omitempty"`
+	LastUsedIP string                      `gorm:"size:64" json:"last_used_ip,omitempty"`
+	RevokedAt  *time.Time                  `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time                   `gorm:"autoCreateTime" json:"created_at"`
+}
+
+type AccessTokenInput struct {
+	Name          string   `json:"name" binding:"required,max=100"`
+	Scopes        []string `json:"scopes" binding:"required,min=1"`
+	ExpiresInDays int      `json:"expires_in_days" binding:"omitempty,min=1,max=365"`
+}
+
+// AuthThrottle counts recent failures for one account or IP on one action
+type AuthThrottle struct {
+	ThrottleKey   string    `gorm:"primaryKey;size:255"`
+	Failures      int       `gorm:"not null;default:0"`
+	LastFailureAt time.Time `gorm:"not null"`
+	LockedUntil   *time.Time
+}
+
 type VerifyPasswordResponse struct {
 	Match bool `json:"match"`
 }
 
+func (Session) TableName() string {
+	return "user_sessions"
+}
+
+func (UserTOTP) TableName() string {
+	return "user_totp"
+}
+
+func (PasswordHistory) TableName() string {
+	return "password_history"
+}
+
+func (RecoveryCode) TableName() string {
+	return "recovery_codes"
+}
+
+func (PersonalAccessToken) TableName() string {
+	return "personal_access_tokens"
+}
+
+func (UserIdentity) TableName() string {
+	return "user_identities"
+}
+
+func (AuthThrottle) TableName() string {
+	return "auth_throttle"
+}
+
+func (RefreshToken) TableName() string {
+	return "refresh_tokens"
+}
+
 func (Role) TableName() string {
 	return "roles"
 }
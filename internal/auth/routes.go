@@ -10,18 +10,50 @@ import (
 func RegisterRoutes(r *gin.Engine, as *AuthService, ls *logs.LogService) {
 	controller := &AuthController{AuthService: as, LS: ls}
 
+	// public keys for verifying access tokens
+	r.GET("/.well-known/jwks.json", controller.JWKS)
+
 	userGroup := r.Group("/api/user")
 
 	{
 		userGroup.POST("/login", controller.Login)
+		userGroup.POST("/login/2fa", controller.LoginTwoFactor)
+		userGroup.POST("/login/2fa/setup", controller.LoginTwoFactorSetup)
+		userGroup.POST("/login/2fa/activate", controller.LoginTwoFactorActivate)
 		userGroup.POST("/signup", controller.SignUp)
+		userGroup.POST("/verify-email", controller.VerifyEmail)
+		userGroup.GET("/oidc/providers", controller.GetOIDCProviders)
+		userGroup.GET("/oidc/:provider/login", controller.OIDCLogin)
+		userGroup.GET("/oidc/:provider/callback", controller.OIDCCallback)
 		userGroup.GET("/me", controller.Me)
 		userGroup.POST("/logout", controller.Logout)
 		userGroup.POST("/refresh", controller.Refresh)
+		userGroup.POST("/logout-all", middlewares.AuthMiddleware(), controller.LogoutAll)
+		userGroup.GET("/sessions", middlewares.AuthMiddleware(), controller.GetSessions)
+		userGroup.DELETE("/sessions/:id", middlewares.AuthMiddleware(), controller.RevokeSession)
+		userGroup.GET("/tokens", middlewares.AuthMiddleware(), controller.GetAccessTokens)
+		userGroup.POST("/tokens", middlewares.AuthMiddleware(), controller.CreateAccessToken)
+		userGroup.DELETE("/tokens/:id", middlewares.AuthMiddleware(), controller.RevokeAccessToken)
+		userGroup.DELETE("/:id/sessions", middlewares.AuthMiddleware(), controller.RevokeUserSessions)
+		userGroup.POST("/:id/verification/resend", middlewares.AuthMiddleware(), controller.ResendVerification)
+		userGroup.POST("/:id/verify", middlewares.AuthMiddleware(), controller.AdminVerifyEmail)
+		userGroup.GET("/2fa", middlewares.AuthMiddleware(), controller.GetTwoFactorStatus)
+		userGroup.POST("/2fa/setup", middlewares.AuthMiddleware(), controller.SetupTwoFactor)
+		userGroup.POST("/2fa/activate", middlewares.AuthMiddleware(), controller.ActivateTwoFactor)
+		userGroup.POST("/2fa/disable", middlewares.AuthMiddleware(), controller.DisableTwoFactor)
+		userGroup.POST("/2fa/recovery-codes", middlewares.AuthMiddleware(), controller.RegenerateRecoveryCodes)
 		userGroup.POST("/verify-password", middlewares.AuthMiddleware(), controller.VerifyPassword)
+		userGroup.POST("/change-password", middlewares.AuthMiddleware(), controller.ChangePassword)
 		userGroup.GET("", middlewares.AuthMiddleware(), controller.GetUsers)
+		userGroup.GET("/all", middlewares.AuthMiddleware(), controller.ListUsers)
+		userGroup.PUT("/:id/role", middlewares.AuthMiddleware(), controller.UpdateUserRole)
+		userGroup.POST("/:id/disable", middlewares.AuthMiddleware(), controller.DisableUser)
+		userGroup.POST("/:id/enable", middlewares.AuthMiddleware(), controller.EnableUser)
+		userGroup.POST("/:id/force-password-reset", middlewares.AuthMiddleware(), controller.ForcePasswordReset)
+		userGroup.DELETE("/:id", middlewares.AuthMiddleware(), controller.DeleteUser)
 		userGroup.POST("/send-otp", controller.SendOTP)
 		userGroup.POST("/reset-password", controller.ResetPassword)
+		userGroup.GET("/password-policy", controller.GetPasswordPolicy)
 	}
 
 	//requestGroup := r.Group("/requests")
@@ -1,21 +1,38 @@
 package auth
 
 import (
+	"crypto/subtle"
 	"errors"
 	"fmt"
 	"log"
-	"net/smtp"
+	"math"
+	"net/url"
 	"nordik-drive-api/config"
+	"nordik-drive-api/internal/mailer"
+	"nordik-drive-api/internal/middlewares"
+	"nordik-drive-api/internal/oidc"
+	"nordik-drive-api/internal/password"
+	"nordik-drive-api/internal/signing"
 	"nordik-drive-api/internal/util"
+	"slices"
 	"strings"
 	"time"
 
+	"github.com/golang-jwt/jwt/v5"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type AuthService struct {
-	DB  *gorm.DB
-	CFG *config.Config
+	DB     *gorm.DB
+	CFG    *config.Config
+	Mailer mailer.Mailer
+	// OIDC holds the configured single sign-on providers by name
+	OIDC map[string]*oidc.Provider
+	// Keys signs access tokens
+	Keys *signing.KeySet
+	// Passwords is the policy new passwords must meet
+	Passwords *password.Policy
 }
 
 func (s *AuthService) CreateUser(user Auth) (*Auth, error) {
@@ -79,6 +96,533 @@ func (s *AuthService) GetAllUsers() ([]Auth, error) {
 	return users, nil
 }
 
+var (
+	ErrAccountDisabled = errors.New("this account has been disabled")
+	ErrPasswordReset   = errors.New("a password reset is required for this account")
+	ErrLastAdmin       = errors.New("there must be at least one active admin")
+	ErrUserOwnsData    = errors.New("user owns files, versions, groups, policies or share links; anonymise the account instead")
+	ErrUnknownRole     = errors.New("unknown role")
+)
+
+// ListUsers pages through every account for the admin user list. Paging
+// defaults are written back to input.
+func (s *AuthService) ListUsers(input *UserListInput) ([]Auth, int64, int, error) {
+	if input.Page <= 0 {
+		input.Page = 1
+	}
+	if input.PageSize <= 0 || input.PageSize > 100 {
+		input.PageSize = 20
+	}
+
+	db := s.DB.Model(&Auth{})
+
+	if input.Search != "" {
+		like := "%" + input.Search + "%"
+		db = db.Where("firstname ILIKE ? OR lastname ILIKE ? OR email ILIKE ?", like, like, like)
+	}
+	if input.Role != "" {
+		db = db.Where("role = ?", input.Role)
+	}
+	switch input.Status {
+	case "active":
+		db = db.Where("disabled_at IS NULL AND email_verified_at IS NOT NULL")
+	case "disabled":
+		db = db.Where("disabled_at IS NOT NULL")
+	case "unverified":
+		db = db.Where("email_verified_at IS NULL")
+	}
+
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, 0, err
+	}
+
+	var users []Auth
+	if err := db.
+		Limit(input.PageSize).
+		Offset((input.Page - 1) * input.PageSize).
+		Order("created_at DESC, id DESC").
+		Find(&users).Error; err != nil {
+		return nil, 0, 0, err
+	}
+
+	totalPages := int(math.Ceil(float64(total) / float64(input.PageSize)))
+	return users, total, totalPages, nil
+}
+
+// ensureOtherAdmin fails if user is the last enabled admin
+func (s *AuthService) ensureOtherAdmin(user *Auth) error {
+	if user.Role != "Admin" {
+		return nil
+	}
+
+	var others int64
+	if err := s.DB.Model(&Auth{}).
+		Where("role = ? AND id <> ? AND disabled_at IS NULL", "Admin", user.ID).
+		Count(&others).Error; err != nil {
+		return err
+	}
+	if others == 0 {
+		return ErrLastAdmin
+	}
+	return nil
+}
+
+// SetUserRole changes the global role of a user
+func (s *AuthService) SetUserRole(user *Auth, role string) error {
+	var count int64
+	if err := s.DB.Model(&Role{}).Where("role = ?", role).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return fmt.Errorf("%w: %s", ErrUnknownRole, role)
+	}
+
+	if role != "Admin" {
+		if err := s.ensureOtherAdmin(user); err != nil {
+			return err
+		}
+	}
+
+	if err := s.DB.Model(&Auth{}).Where("id = ?", user.ID).Update("role", role).Error; err != nil {
+		return err
+	}
+	user.Role = role
+	return nil
+}
+
+// SetUserDisabled disables or re-enables an account. Disabling also signs the
+// user out everywhere.
+func (s *AuthService) SetUserDisabled(user *Auth, disabled bool) error {
+	var disabledAt *time.Time
+	if disabled {
+		if err := s.ensureOtherAdmin(user); err != nil {
+			return err
+		}
+		now := time.Now()
+		disabledAt = &now
+	}
+
+	if err := s.DB.Model(&Auth{}).Where("id = ?", user.ID).Update("disabled_at", disabledAt).Error; err != nil {
+		return err
+	}
+	user.DisabledAt = disabledAt
+
+	if disabled {
+		if _, err := s.RevokeAllSessions(user.ID, "account disabled"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var ErrResetMailFailed = errors.New("password reset required, but the reset code could not be emailed")
+
+// ForcePasswordReset blocks login until the user resets their password, signs
+// them out everywhere and mails them a reset code right away, ignoring the
+// resend cooldown. ErrResetMailFailed means everything but the mail worked.
+func (s *AuthService) ForcePasswordReset(user *Auth) error {
+	if err := s.DB.Model(&Auth{}).Where("id = ?", user.ID).Update("password_reset_required", true).Error; err != nil {
+		return err
+	}
+	user.PasswordResetRequired = true
+
+	if _, err := s.RevokeAllSessions(user.ID, "password reset required"); err != nil {
+		return err
+	}
+	if err := s.mailOTP(user); err != nil {
+		log.Printf("Failed to send forced reset code: %v", err)
+		return ErrResetMailFailed
+	}
+	return nil
+}
+
+// DeleteUser removes an account and everything that only belongs to it. Users
+// that uploaded files or versions, created groups, policies or share links
+// can only be anonymised, since deleting them would cascade to shared data,
+// including versions they uploaded of someone else's file.
+func (s *AuthService) DeleteUser(user *Auth) error {
+	if err := s.ensureOtherAdmin(user); err != nil {
+		return err
+	}
+
+	var owned bool
+	if err := s.DB.Raw(`
+		SELECT EXISTS (SELECT 1 FROM file WHERE inserted_by = @id)
+		    OR EXISTS (SELECT 1 FROM file_version WHERE inserted_by = @id)
+		    OR EXISTS (SELECT 1 FROM file_data WHERE inserted_by = @id)
+		    OR EXISTS (SELECT 1 FROM file_share_link WHERE created_by = @id)
+		    OR EXISTS (SELECT 1 FROM user_groups WHERE created_by = @id)
+		    OR EXISTS (SELECT 1 FROM file_policy WHERE created_by = @id)
+	`, map[string]interface{}{"id": user.ID}).Scan(&owned).Error; err != nil {
+		return err
+	}
+	if owned {
+		return ErrUserOwnsData
+	}
+
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", user.ID).Delete(&UserRole{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("email = ?", otpEmail(user.Email)).Delete(&OTP{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&Auth{}, user.ID).Error
+	})
+}
+
+// AnonymiseUser keeps the row, so uploads and logs still resolve, but strips
+// every personal detail, disables the account and drops its memberships and
+// grants
+func (s *AuthService) AnonymiseUser(user *Auth) error {
+	if err := s.ensureOtherAdmin(user); err != nil {
+		return err
+	}
+
+	random, err := util.GenerateToken(32)
+	if err != nil {
+		return err
+	}
+	password, err := util.HashPassword(random)
+	if err != nil {
+		return err
+	}
+
+	originalEmail := user.Email
+	now := time.Now()
+
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&Auth{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+			"firstname":   "Deleted",
+			"lastname":    "User",
+			"email":       fmt.Sprintf("deleted-user-%d@anonymised.invalid", user.ID),
+			"password":    password,
+			"disabled_at": now,
+		}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&Session{}).Where("user_id = ? AND revoked_at IS NULL", user.ID).
+			Updates(map[string]interface{}{"revoked_at": now, "revoked_reason": "account anonymised"}).Error; err != nil {
+			return err
+		}
+
+		for _, q := range []string{
+			"DELETE FROM user_roles WHERE user_id = ?",
+			"DELETE FROM user_group_members WHERE user_id = ?",
+			"DELETE FROM file_access WHERE user_id = ?",
+			"DELETE FROM user_totp WHERE user_id = ?",
+			"DELETE FROM recovery_codes WHERE user_id = ?",
+			"DELETE FROM password_history WHERE user_id = ?",
+			"DELETE FROM personal_access_tokens WHERE user_id = ?",
+			"DELETE FROM user_identities WHERE user_id = ?",
+		} {
+			if err := tx.Exec(q, user.ID).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Where("email = ?", otpEmail(originalEmail)).Delete(&OTP{}).Error
+	})
+}
+
+// NewOIDCProviders builds the single sign-on providers from config. Each
+// provider calls back to /api/user/oidc/<name>/callback on this API.
+func NewOIDCProviders(cfg *config.Config) map[string]*oidc.Provider {
+	providers := make(map[string]*oidc.Provider, len(cfg.OIDCProviders))
+	for _, p := range cfg.OIDCProviders {
+		if p.Issuer == "" || p.ClientID == "" {
+			log.Printf("Skipping OIDC provider %s: issuer and client ID are required", p.Name)
+			continue
+		}
+		providers[p.Name] = oidc.NewProvider(oidc.Config{
+			Name:         p.Name,
+			Issuer:       p.Issuer,
+			ClientID:     p.ClientID,
+			ClientSecret: p.ClientSecret,
+			RedirectURL:  strings.TrimRight(cfg.OIDCRedirectBaseURL, "/") + "/api/user/oidc/" + p.Name + "/callback",
+			TrustEmail:   p.TrustEmail,
+		})
+	}
+	return providers
+}
+
+const oidcStateTTL = 10 * time.Minute
+
+var ErrInvalidOIDCState = errors.New("invalid or expired sign-in state")
+
+// OIDCState is kept in a signed cookie between the login redirect and the
+// callback
+type OIDCState struct {
+	State      string
+	Nonce      string
+	Verifier   string
+	RememberMe bool
+}
+
+// NewOIDCState generates the state, nonce and PKCE verifier for one login
+// and returns them with the signed cookie value that carries them
+func (s *AuthService) NewOIDCState(provider string, rememberMe bool) (*OIDCState, string, error) {
+	var values [3]string
+	for i := range values {
+		v, err := util.GenerateToken(32)
+		if err != nil {
+			return nil, "", err
+		}
+		values[i] = v
+	}
+	state := &OIDCState{State: values[0], Nonce: values[1], Verifier: values[2], RememberMe: rememberMe}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"purpose":     challengeOIDC,
+		"provider":    provider,
+		"state":       state.State,
+		"nonce":       state.Nonce,
+		"verifier":    state.Verifier,
+		"remember_me": rememberMe,
+		"exp":         time.Now().Add(oidcStateTTL).Unix(),
+	})
+	signed, err := token.SignedString([]byte(s.CFG.JWTSecret))
+	if err != nil {
+		return nil, "", err
+	}
+	return state, signed, nil
+}
+
+// ParseOIDCState checks the cookie against the provider and the state
+// parameter returned in the callback
+func (s *AuthService) ParseOIDCState(cookie, provider, state string) (*OIDCState, error) {
+	token, err := jwt.Parse(cookie, func(token *jwt.Token) (interface{}, error) {
+		return []byte(s.CFG.JWTSecret), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidOIDCState
+	}
+
+	claims := token.Claims.(jwt.MapClaims)
+	if claims["purpose"] != challengeOIDC || claims["provider"] != provider {
+		return nil, ErrInvalidOIDCState
+	}
+
+	parsed := &OIDCState{}
+	parsed.State, _ = claims["state"].(string)
+	parsed.Nonce, _ = claims["nonce"].(string)
+	parsed.Verifier, _ = claims["verifier"].(string)
+	parsed.RememberMe, _ = claims["remember_me"].(bool)
+
+	if parsed.State == "" || subtle.ConstantTimeCompare([]byte(parsed.State), []byte(state)) != 1 {
+		return nil, ErrInvalidOIDCState
+	}
+	return parsed, nil
+}
+
+var (
+	ErrSSOEmailUnverified = errors.New("your identity provider has not verified this email address")
+	ErrSSONoAccount       = errors.New("no account exists for this email, ask an administrator for an invitation")
+)
+
+// ResolveOIDCUser finds the user for an external identity. Unknown identities
+// are linked to the user with the same verified email, or, with auto
+// provisioning on, to a new account with the default role.
+func (s *AuthService) ResolveOIDCUser(provider string, claims *oidc.Claims) (*Auth, bool, error) {
+	var user Auth
+	var created bool
+	now := time.Now()
+
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		var identity UserIdentity
+		err := tx.Where("provider = ? AND subject = ?", provider, claims.Subject).First(&identity).Error
+		if err == nil {
+			if err := tx.First(&user, identity.UserID).Error; err != nil {
+				return err
+			}
+			return tx.Model(&identity).Update("last_login_at", now).Error
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		email := strings.ToLower(strings.TrimSpace(claims.Email))
+		if email == "" || !claims.EmailVerified {
+			return ErrSSOEmailUnverified
+		}
+
+		err = tx.Where("LOWER(email) = ?", email).First(&user).Error
+		switch {
+		case err == nil:
+			// The provider vouches for the address, which is as good as our own link
+			if user.EmailVerifiedAt == nil {
+				if err := tx.Model(&user).Update("email_verified_at", now).Error; err != nil {
+					return err
+				}
+				user.EmailVerifiedAt = &now
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			if !s.CFG.OIDCAutoProvision {
+				return ErrSSONoAccount
+			}
+			if err := s.provisionOIDCUser(tx, &user, email, claims, now); err != nil {
+				return err
+			}
+			created = true
+		default:
+			return err
+		}
+
+		return tx.Create(&UserIdentity{
+			UserID:      user.ID,
+			Provider:    provider,
+			Subject:     claims.Subject,
+			Email:       email,
+			LastLoginAt: &now,
+		}).Error
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return &user, created, nil
+}
+
+func (s *AuthService) provisionOIDCUser(tx *gorm.DB, user *Auth, email string, claims *oidc.Claims, now time.Time) error {
+	// SSO users sign in through their provider; the local password is random
+	// until they set one with a reset
+	random, err := util.GenerateToken(32)
+	if err != nil {
+		return err
+	}
+	password, err := util.HashPassword(random)
+	if err != nil {
+		return err
+	}
+
+	first, last := claims.GivenName, claims.FamilyName
+	if first == "" && last == "" {
+		first, last, _ = strings.Cut(claims.Name, " ")
+	}
+	if first == "" {
+		first, _, _ = strings.Cut(email, "@")
+	}
+
+	*user = Auth{
+		FirstName:       first,
+		LastName:        last,
+		Email:           email,
+		Password:        password,
+		Role:            s.CFG.OIDCDefaultRole,
+		EmailVerifiedAt: &now,
+	}
+	return tx.Create(user).Error
+}
+
+const (
+	accessTokenPrefix      = "ndp_"
+	defaultAccessTokenDays = 90
+	// last use is written at most this often per token
+	accessTokenTouchInterval = time.Minute
+)
+
+var ErrInvalidAccessToken = errors.New("invalid or expired access token")
+
+// CreateAccessToken issues a personal access token and returns it with the
+// raw token, which is never stored
+func (s *AuthService) CreateAccessToken(userID int, input AccessTokenInput) (*PersonalAccessToken, string, error) {
+	scopes := make([]string, 0, len(input.Scopes))
+	for _, scope := range input.Scopes {
+		if !slices.Contains(middlewares.Scopes, scope) {
+			return nil, "", fmt.Errorf("unknown scope: %s", scope)
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	days := input.ExpiresInDays
+	if days == 0 {
+		days = defaultAccessTokenDays
+	}
+
+	random, err := util.GenerateToken(32)
+	if err != nil {
+		return nil, "", err
+	}
+	raw := accessTokenPrefix + random
+
+	token := PersonalAccessToken{
+		UserID:    userID,
+		Name:      strings.TrimSpace(input.Name),
+		Prefix:    raw[:len(accessTokenPrefix)+6],
+		TokenHash: util.HashToken(raw),
+		Scopes:    scopes,
+		ExpiresAt: time.Now().AddDate(0, 0, days),
+	}
+	if err := s.DB.Create(&token).Error; err != nil {
+		return nil, "", err
+	}
+	return &token, raw, nil
+}
+
+// GetAccessTokens lists the user's tokens that are not revoked, including
+// expired ones so the user can see why a script stopped working
+func (s *AuthService) GetAccessTokens(userID int) ([]PersonalAccessToken, error) {
+	var tokens []PersonalAccessToken
+	if err := s.DB.Where("user_id = ? AND revoked_at IS NULL", userID).
+		Order("created_at DESC").
+		Find(&tokens).Error; err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// RevokeAccessToken revokes one token, only if it belongs to the user
+func (s *AuthService) RevokeAccessToken(userID int, tokenID string) (*PersonalAccessToken, error) {
+	var token PersonalAccessToken
+	if err := s.DB.Where("id = ? AND user_id = ? AND revoked_at IS NULL", tokenID, userID).First(&token).Error; err != nil {
+		return nil, errors.New("access token not found")
+	}
+
+	now := time.Now()
+	if err := s.DB.Model(&token).Update("revoked_at", now).Error; err != nil {
+		return nil, err
+	}
+	token.RevokedAt = &now
+	return &token, nil
+}
+
+// AuthenticateBearer resolves a raw personal access token for the auth
+// middleware and records its last use
+func (s *AuthService) AuthenticateBearer(raw, ip string) (uint, []string, error) {
+	if !strings.HasPrefix(raw, accessTokenPrefix) {
+		return 0, nil, ErrInvalidAccessToken
+	}
+
+	var token PersonalAccessToken
+	if err := s.DB.Where("token_hash = ? AND revoked_at IS NULL AND expires_at > ?", util.HashToken(raw), time.Now()).
+		First(&token).Error; err != nil {
+		return 0, nil, ErrInvalidAccessToken
+	}
+
+	user, err := s.GetUserByID(token.UserID)
+	if err != nil {
+		return 0, nil, ErrInvalidAccessToken
+	}
+	if user.DisabledAt != nil {
+		return 0, nil, ErrAccountDisabled
+	}
+	if user.EmailVerifiedAt == nil {
+		return 0, nil, ErrEmailNotVerified
+	}
+
+	now := time.Now()
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) > accessTokenTouchInterval || token.LastUsedIP != ip {
+		if err := s.DB.Model(&token).Updates(map[string]interface{}{"last_used_at": now, "last_used_ip": ip}).Error; err != nil {
+			log.Printf("Failed to record access token use: %v", err)
+		}
+	}
+
+	return uint(user.ID), token.Scopes, nil
+}
+
 type AccessWithUser struct {
 	CommunityName string    `json:"community_name"`
 	Filename      *string   `json:"filename,omitempty"`
@@ -89,95 +633,993 @@ type AccessWithUser struct {
 	CreatedAt     time.Time `json:"created_at"`
 }
 
-func (s *AuthService) SendOTP(email string) (string, error) {
-	// Check if user exists
+const (
+	otpTTL            = 10 * time.Minute
+	otpResendCooldown = time.Minute
+)
+
+var (
+	ErrInvalidOTP = errors.New("invalid OTP")
+	ErrOTPExpired = errors.New("OTP expired")
+)
+
+func (s *AuthService) hashOTP(email, code string) string {
+	return util.HMACToken(strings.ToLower(email)+":"+code, s.CFG.JWTSecret)
+}
+
+// otpEmail is the form of an address OTPs are stored and looked up under
+func otpEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// SendOTP mails a new reset code to the user in the background and
+// invalidates any earlier one. Unknown emails and requests inside the resend
+// cooldown are silently ignored, and nothing is reported back, so neither the
+// response nor its timing tells the caller whether the account exists.
+func (s *AuthService) SendOTP(email string) {
+	email = otpEmail(email)
+	go func() {
+		if err := s.sendOTP(email); err != nil {
+			log.Printf("Failed to send OTP: %v", err)
+		}
+	}()
+}
+
+func (s *AuthService) sendOTP(email string) error {
 	var user Auth
-	if err := s.DB.Where("email = ?", email).First(&user).Error; err != nil {
-		return "", errors.New("user not found")
+	if err := s.DB.Where("LOWER(email) = ?", email).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
 	}
 
+	var recent int64
+	if err := s.DB.Model(&OTP{}).
+		Where("email = ? AND created_at > ?", email, time.Now().Add(-otpResendCooldown)).
+		Count(&recent).Error; err != nil {
+		return err
+	}
+	if recent > 0 {
+		return nil
+	}
+
+	return s.mailOTP(&user)
+}
+
+// mailOTP replaces any earlier code of the user with a new one and mails it
+func (s *AuthService) mailOTP(user *Auth) error {
+	email := otpEmail(user.Email)
+
 	// Generate 6-digit OTP
 	otp := fmt.Sprintf("%06d", util.RandomInt(100000, 999999))
 
-	// Save to DB
-	record := OTP{
-		Email: email,
-		Code:  otp,
-	}
-	if err := s.DB.Create(&record).Error; err != nil {
-		return "", err
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("email = ?", email).Delete(&OTP{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&OTP{Email: email, CodeHash: s.hashOTP(email, otp)}).Error
+	})
+	if err != nil {
+		return err
 	}
 
-	from := s.CFG.GmailUser
-	password := s.CFG.GmailPass
-	to := []string{user.Email}
-	smtpHost := "smtp.gmail.com"
-	smtpPort := "587"
-
-	subject := "OTP to change password"
-	body := fmt.Sprintf(
-		"Hi there,\n\n"+
-			"Your OTP to change the password is: %s\n\n"+
-			"This code will expire in 10 minutes.\n\n"+
-			"Thank you.",
-		otp,
-	)
-
-	// 2. Format the email message.
-	// The email header and body must be formatted correctly with \r\n
-	// to ensure it's a valid email message.
-	message := []byte(fmt.Sprintf(
-		"To: %s\r\n"+
-			"Subject: %s\r\n"+
-			"\r\n"+
-			"%s",
-		user.Email,
-		subject,
-		body,
-	))
-
-	// 3. Authenticate with the SMTP server.
-	// This is the required step to prove your application has permission.
-	auth := smtp.PlainAuth("", from, password, smtpHost)
-
-	// 4. Send the email.
-	// This function connects to the server, authenticates, and sends the message.
-	err := smtp.SendMail(smtpHost+":"+smtpPort, auth, from, to, message)
-	if err != nil {
-		log.Printf("Error sending email to %s: %v\n", user.Email, err)
-		return "", errors.New("failed to send OTP email")
+	data := map[string]any{"Code": otp, "ExpiresInMinutes": int(otpTTL.Minutes())}
+	if err := mailer.SendTemplate(s.Mailer, user.Email, "otp", data); err != nil {
+		return fmt.Errorf("failed to send OTP email to %s: %w", user.Email, err)
 	}
 
-	return otp, nil
+	return nil
 }
 
-// Verify OTP and reset password
+// Verify OTP and reset password. Only the latest unused code counts; it is
+// consumed on success and discarded after too many wrong guesses. A password
+// the policy rejects leaves the code usable for another try.
 func (s *AuthService) ResetPassword(email, code, newPassword string) error {
-	// Get latest OTP for email
+	email = otpEmail(email)
+
 	var otp OTP
-	if err := s.DB.Where("email = ? AND code = ?", email, code).
+	if err := s.DB.Where("email = ? AND used_at IS NULL", email).
 		Order("created_at desc").First(&otp).Error; err != nil {
-		return errors.New("invalid OTP")
+		return ErrInvalidOTP
+	}
+
+	if time.Since(otp.CreatedAt) > otpTTL {
+		return ErrOTPExpired
+	}
+
+	if subtle.ConstantTimeCompare([]byte(otp.CodeHash), []byte(s.hashOTP(email, code))) != 1 {
+		otp.Attempts++
+		if otp.Attempts >= otpAttemptLimit {
+			if err := s.DB.Delete(&otp).Error; err != nil {
+				return err
+			}
+			return errors.New("too many invalid attempts, request a new OTP")
+		}
+		if err := s.DB.Model(&otp).Update("attempts", otp.Attempts).Error; err != nil {
+			return err
+		}
+		return ErrInvalidOTP
+	}
+
+	user := &Auth{}
+	if err := s.DB.Where("LOWER(email) = ?", email).First(user).Error; err != nil {
+		return ErrInvalidOTP
 	}
 
-	// Check if OTP is older than 10 minutes
-	if time.Since(otp.CreatedAt) > 10*time.Minute {
-		return errors.New("OTP expired")
+	if err := s.CheckNewPassword(user, newPassword); err != nil {
+		return err
 	}
 
-	// Update user password
 	hashed, err := util.HashPassword(newPassword)
 	if err != nil {
 		return err
 	}
-	if err := s.DB.Model(&Auth{}).Where("email = ?", email).
-		Update("password", hashed).Error; err != nil {
+
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		// Consume the code first so two concurrent resets can't both use it
+		res := tx.Model(&OTP{}).Where("id = ? AND used_at IS NULL", otp.ID).Update("used_at", time.Now())
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrInvalidOTP
+		}
+
+		if err := s.replacePassword(tx, user, hashed); err != nil {
+			return err
+		}
+
+		// whoever knew the old password may still hold a session
+		return tx.Model(&Session{}).Where("user_id = ? AND revoked_at IS NULL", user.ID).
+			Updates(map[string]interface{}{"revoked_at": time.Now(), "revoked_reason": "password reset"}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	s.NotifyPasswordChanged(user)
+	return nil
+}
+
+var ErrPasswordReused = errors.New("password was used recently, choose a different one")
+
+// CheckNewPassword applies the password policy. For an existing user it also
+// refuses the current password and those kept in the password history.
+func (s *AuthService) CheckNewPassword(user *Auth, newPassword string) error {
+	if err := s.Passwords.Validate(newPassword); err != nil {
+		return err
+	}
+
+	if user == nil || s.Passwords.History < 1 {
+		return nil
+	}
+
+	if util.VerifyPassword(newPassword, user.Password) == nil {
+		return ErrPasswordReused
+	}
+
+	var previous []PasswordHistory
+	if err := s.DB.Where("user_id = ?", user.ID).
+		Order("id desc").Limit(s.Passwords.History - 1).Find(&previous).Error; err != nil {
+		return err
+	}
+	for _, p := range previous {
+		if util.VerifyPassword(newPassword, p.Password) == nil {
+			return ErrPasswordReused
+		}
+	}
+	return nil
+}
+
+// replacePassword stores the new hash, moves the old one into the history and
+// trims the history to what the policy still needs
+func (s *AuthService) replacePassword(tx *gorm.DB, user *Auth, hashed string) error {
+	if err := tx.Model(&Auth{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+		"password":                hashed,
+		"password_reset_required": false,
+	}).Error; err != nil {
+		return err
+	}
+
+	keep := max(s.Passwords.History-1, 0)
+	if keep > 0 {
+		if err := tx.Create(&PasswordHistory{UserID: user.ID, Password: user.Password}).Error; err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Exec(`DELETE FROM password_history WHERE user_id = ? AND id NOT IN (
+		SELECT id FROM password_history WHERE user_id = ? ORDER BY id DESC LIMIT ?)`,
+		user.ID, user.ID, keep).Error; err != nil {
 		return err
 	}
 
+	user.Password = hashed
+	user.PasswordResetRequired = false
 	return nil
 }
 
+// ChangePassword replaces the password of a signed in user, whose current
+// password the caller has already checked, and signs out every other session
+func (s *AuthService) ChangePassword(user *Auth, newPassword string, currentSession uint) (int64, error) {
+	if err := s.CheckNewPassword(user, newPassword); err != nil {
+		return 0, err
+	}
+
+	hashed, err := util.HashPassword(newPassword)
+	if err != nil {
+		return 0, err
+	}
+
+	var revoked int64
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := s.replacePassword(tx, user, hashed); err != nil {
+			return err
+		}
+
+		res := tx.Model(&Session{}).Where("user_id = ? AND revoked_at IS NULL AND id <> ?", user.ID, currentSession).
+			Updates(map[string]interface{}{"revoked_at": time.Now(), "revoked_reason": "password changed"})
+		revoked = res.RowsAffected
+		return res.Error
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	s.NotifyPasswordChanged(user)
+	return revoked, nil
+}
+
+const emailVerificationTTL = 48 * time.Hour
+
+var (
+	ErrEmailNotVerified     = errors.New("please verify your email address before continuing")
+	ErrInvalidVerification  = errors.New("invalid or expired verification link")
+	ErrEmailAlreadyVerified = errors.New("email is already verified")
+)
+
+// SignEmailVerification signs a link token bound to the user's current email,
+// so it stops working if the address changes
+func (s *AuthService) SignEmailVerification(user *Auth) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id": user.ID,
+		"email":   user.Email,
+		"purpose": challengeVerifyEmail,
+		"exp":     time.Now().Add(emailVerificationTTL).Unix(),
+	})
+	return token.SignedString([]byte(s.CFG.JWTSecret))
+}
+
+// SendSignupConfirmation mails the user a link to verify their email address
+func (s *AuthService) SendSignupConfirmation(user *Auth) error {
+	if user.EmailVerifiedAt != nil {
+		return ErrEmailAlreadyVerified
+	}
+
+	token, err := s.SignEmailVerification(user)
+	if err != nil {
+		return err
+	}
+
+	data := map[string]any{
+		"FirstName":      user.FirstName,
+		"Email":          user.Email,
+		"Link":           strings.TrimRight(s.CFG.AppURL, "/") + "/verify-email?token=" + url.QueryEscape(token),
+		"ExpiresInHours": int(emailVerificationTTL.Hours()),
+	}
+	return mailer.SendTemplate(s.Mailer, user.Email, "signup_confirmation", data)
+}
+
+// VerifyEmail checks a link token and marks the user verified. Verifying an
+// already verified user is not an error.
+func (s *AuthService) VerifyEmail(tokenString string) (*Auth, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		return []byte(s.CFG.JWTSecret), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidVerification
+	}
+
+	claims := token.Claims.(jwt.MapClaims)
+	if claims["purpose"] != challengeVerifyEmail {
+		return nil, ErrInvalidVerification
+	}
+	userID, ok := claims["user_id"].(float64)
+	if !ok {
+		return nil, ErrInvalidVerification
+	}
+
+	user, err := s.GetUserByID(int(userID))
+	if err != nil || !strings.EqualFold(user.Email, fmt.Sprint(claims["email"])) {
+		return nil, ErrInvalidVerification
+	}
+
+	if user.EmailVerifiedAt == nil {
+		if err := s.MarkEmailVerified(user); err != nil {
+			return nil, err
+		}
+	}
+	return user, nil
+}
+
+// MarkEmailVerified verifies the user without a link, for admins
+func (s *AuthService) MarkEmailVerified(user *Auth) error {
+	now := time.Now()
+	if err := s.DB.Model(&Auth{}).Where("id = ?", user.ID).Update("email_verified_at", now).Error; err != nil {
+		return err
+	}
+	user.EmailVerifiedAt = &now
+	return nil
+}
+
+// NotifyPasswordChanged warns the user that their password was changed.
+// Delivery failures are only logged.
+func (s *AuthService) NotifyPasswordChanged(user *Auth) {
+	data := map[string]any{"FirstName": user.FirstName, "Email": user.Email, "ChangedAt": time.Now()}
+	if err := mailer.SendTemplate(s.Mailer, user.Email, "password_changed", data); err != nil {
+		log.Printf("Failed to send password change notice to %s: %v", user.Email, err)
+	}
+}
+
+// DeleteStaleOTPs removes used and expired reset codes
+func (s *AuthService) DeleteStaleOTPs() error {
+	return s.DB.Where("used_at IS NOT NULL OR created_at < ?", time.Now().Add(-otpTTL)).Delete(&OTP{}).Error
+}
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReuse   = errors.New("refresh token reuse detected")
+)
+
+const (
+	accessTokenTTL       = 15 * time.Minute
+	refreshTokenTTL      = 24 * time.Hour
+	rememberMeRefreshTTL = 30 * 24 * time.Hour
+
+	// a rotated token presented again within this window is treated as a
+	// concurrent refresh from another tab rather than theft
+	refreshReuseGrace = 10 * time.Second
+)
+
+func refreshTTL(rememberMe bool) time.Duration {
+	if rememberMe {
+		return rememberMeRefreshTTL
+	}
+	return refreshTokenTTL
+}
+
+// CreateSession starts a new session and returns it with its first refresh token
+func (s *AuthService) CreateSession(userID int, rememberMe bool, userAgent, ip string) (*Session, string, error) {
+	now := time.Now()
+	session := Session{
+		UserID:     userID,
+		UserAgent:  userAgent,
+		IPAddress:  ip,
+		RememberMe: rememberMe,
+		LastUsedAt: now,
+		ExpiresAt:  now.Add(refreshTTL(rememberMe)),
+	}
+
+	var raw string
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&session).Error; err != nil {
+			return err
+		}
+
+		var err error
+		raw, err = issueRefreshToken(tx, &session)
+		return err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return &session, raw, nil
+}
+
+func issueRefreshToken(tx *gorm.DB, session *Session) (string, error) {
+	raw, err := util.GenerateToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	token := RefreshToken{
+		SessionID: session.ID,
+		TokenHash: util.HashToken(raw),
+		ExpiresAt: session.ExpiresAt,
+	}
+	if err := tx.Create(&token).Error; err != nil {
+		return "", err
+	}
+	return raw, nil
+}
+
+// RotateRefreshToken exchanges a refresh token for a new one. Presenting a
+// token that was already rotated revokes the whole session.
+func (s *AuthService) RotateRefreshToken(raw, userAgent, ip string) (*Session, string, error) {
+	var session Session
+	var newRaw string
+	var reused bool
+
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		var token RefreshToken
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", util.HashToken(raw)).
+			First(&token).Error; err != nil {
+			return ErrInvalidRefreshToken
+		}
+
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&session, token.SessionID).Error; err != nil {
+			return ErrInvalidRefreshToken
+		}
+
+		now := time.Now()
+		if session.RevokedAt != nil || now.After(session.ExpiresAt) || now.After(token.ExpiresAt) {
+			return ErrInvalidRefreshToken
+		}
+
+		if token.UsedAt != nil {
+			if now.Sub(*token.UsedAt) <= refreshReuseGrace {
+				return ErrInvalidRefreshToken
+			}
+			reused = true
+			return revokeSession(tx, &session, "refresh token reuse")
+		}
+
+		if err := tx.Model(&token).Update("used_at", now).Error; err != nil {
+			return err
+		}
+
+		session.LastUsedAt = now
+		session.ExpiresAt = now.Add(refreshTTL(session.RememberMe))
+		session.UserAgent = userAgent
+		session.IPAddress = ip
+		if err := tx.Save(&session).Error; err != nil {
+			return err
+		}
+
+		var err error
+		newRaw, err = issueRefreshToken(tx, &session)
+		return err
+	})
+
+	if reused {
+		return &session, "", ErrRefreshTokenReuse
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	return &session, newRaw, nil
+}
+
+func revokeSession(tx *gorm.DB, session *Session, reason string) error {
+	now := time.Now()
+	if err := tx.Model(session).Updates(map[string]interface{}{
+		"revoked_at":     now,
+		"revoked_reason": reason,
+	}).Error; err != nil {
+		return err
+	}
+	session.RevokedAt = &now
+	session.RevokedReason = reason
+	return nil
+}
+
+// RevokeSessionByToken ends the session owning the refresh token, used on logout
+func (s *AuthService) RevokeSessionByToken(raw, reason string) (*Session, error) {
+	var token RefreshToken
+	if err := s.DB.Where("token_hash = ?", util.HashToken(raw)).First(&token).Error; err != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	var session Session
+	if err := s.DB.First(&session, token.SessionID).Error; err != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+	if session.RevokedAt != nil {
+		return &session, nil
+	}
+
+	if err := revokeSession(s.DB, &session, reason); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// RevokeAllSessions ends every active session of the user
+func (s *AuthService) RevokeAllSessions(userID int, reason string) (int64, error) {
+	result := s.DB.Model(&Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Updates(map[string]interface{}{
+			"revoked_at":     time.Now(),
+			"revoked_reason": reason,
+		})
+	return result.RowsAffected, result.Error
+}
+
+// SignAccessToken issues a short-lived access token for a session
+func (s *AuthService) SignAccessToken(userID int, sessionID uint) (string, error) {
+	return s.Keys.Sign(jwt.MapClaims{
+		"user_id": userID,
+		"sid":     sessionID,
+		"exp":     time.Now().Add(accessTokenTTL).Unix(),
+	})
+}
+
+var ErrSessionRevoked = errors.New("session has been signed out")
+
+// ValidateAccessClaims rejects access tokens whose session was revoked or
+// expired, or whose user is disabled or has not verified their email
+func (s *AuthService) ValidateAccessClaims(claims jwt.MapClaims) error {
+	sid, ok := claims["sid"].(float64)
+	if !ok {
+		return nil
+	}
+
+	var session struct {
+		RevokedAt       *time.Time
+		ExpiresAt       time.Time
+		EmailVerifiedAt *time.Time
+		DisabledAt      *time.Time
+	}
+	if err := s.DB.Table("user_sessions").
+		Select("user_sessions.revoked_at, user_sessions.expires_at, users.email_verified_at, users.disabled_at").
+		Joins("JOIN users ON users.id = user_sessions.user_id").
+		Where("user_sessions.id = ?", uint(sid)).
+		Take(&session).Error; err != nil {
+		return ErrSessionRevoked
+	}
+	if session.RevokedAt != nil || time.Now().After(session.ExpiresAt) {
+		return ErrSessionRevoked
+	}
+	if session.DisabledAt != nil {
+		return ErrAccountDisabled
+	}
+	if session.EmailVerifiedAt == nil {
+		return ErrEmailNotVerified
+	}
+	return nil
+}
+
+// GetActiveSessions lists the user's sessions that are still usable
+func (s *AuthService) GetActiveSessions(userID int) ([]Session, error) {
+	var sessions []Session
+	if err := s.DB.
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_used_at DESC").
+		Find(&sessions).Error; err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// RevokeUserSession ends one session, only if it belongs to the user
+func (s *AuthService) RevokeUserSession(userID int, sessionID string, reason string) (*Session, error) {
+	var session Session
+	if err := s.DB.Where("id = ? AND user_id = ? AND revoked_at IS NULL", sessionID, userID).First(&session).Error; err != nil {
+		return nil, errors.New("session not found")
+	}
+
+	if err := revokeSession(s.DB, &session, reason); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// DeleteStaleSessions removes expired refresh tokens and sessions that ended
+// more than a week ago
+func (s *AuthService) DeleteStaleSessions() error {
+	now := time.Now()
+	if err := s.DB.Where("expires_at <= ?", now).Delete(&RefreshToken{}).Error; err != nil {
+		return err
+	}
+
+	cutoff := now.AddDate(0, 0, -7)
+	return s.DB.Where("expires_at <= ? OR revoked_at <= ?", cutoff, cutoff).Delete(&Session{}).Error
+}
+
+// StartSessionSweeper periodically cleans up expired sessions, refresh tokens,
+// login throttles and reset codes
+func (s *AuthService) StartSessionSweeper(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if err := s.DeleteStaleSessions(); err != nil {
+				log.Printf("Failed to remove stale sessions: %v", err)
+			}
+			if err := s.DeleteStaleThrottles(); err != nil {
+				log.Printf("Failed to remove stale login throttles: %v", err)
+			}
+			if err := s.DeleteStaleOTPs(); err != nil {
+				log.Printf("Failed to remove stale OTPs: %v", err)
+			}
+		}
+	}()
+}
+
+type ThrottleLockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *ThrottleLockedError) Error() string {
+	return fmt.Sprintf("too many failed attempts, try again in %d seconds", int(e.RetryAfter.Seconds())+1)
+}
+
+// Lockout describes a key that just became locked
+type Lockout struct {
+	Key   string
+	Until time.Time
+}
+
+const (
+	// failures are forgotten after this long without a new one
+	throttleWindow = time.Hour
+	// first lockout duration, doubled for every further failure
+	throttleBaseLockout = time.Minute
+	throttleMaxLockout  = time.Hour
+
+	accountFailureLimit = 5
+	ipFailureLimit      = 20
+	otpAttemptLimit     = 5
+)
+
+func AccountThrottleKey(action, account string) string {
+	return action + ":account:" + strings.ToLower(strings.TrimSpace(account))
+}
+
+func IPThrottleKey(action, ip string) string {
+	return action + ":ip:" + ip
+}
+
+func throttleLimit(key string) int {
+	if strings.Contains(key, ":ip:") {
+		return ipFailureLimit
+	}
+	return accountFailureLimit
+}
+
+// CheckThrottle returns a ThrottleLockedError if any of the keys is locked
+func (s *AuthService) CheckThrottle(keys ...string) error {
+	var throttles []AuthThrottle
+	if err := s.DB.Where("throttle_key IN ? AND locked_until > ?", keys, time.Now()).Find(&throttles).Error; err != nil {
+		return err
+	}
+
+	var longest time.Duration
+	for _, t := range throttles {
+		if wait := time.Until(*t.LockedUntil); wait > longest {
+			longest = wait
+		}
+	}
+	if longest > 0 {
+		return &ThrottleLockedError{RetryAfter: longest}
+	}
+	return nil
+}
+
+// RecordFailure counts a failed attempt for each key and locks keys that
+// passed their limit, with the lockout doubling for every further failure.
+// It returns the keys that were locked by this failure.
+func (s *AuthService) RecordFailure(keys ...string) ([]Lockout, error) {
+	now := time.Now()
+	var lockouts []Lockout
+
+	for _, key := range keys {
+		var failures int
+		if err := s.DB.Raw(`
+			INSERT INTO auth_throttle (throttle_key, failures, last_failure_at)
+			VALUES (?, 1, ?)
+			ON CONFLICT (throttle_key) DO UPDATE SET
+				failures = CASE WHEN auth_throttle.last_failure_at < ? THEN 1 ELSE auth_throttle.failures + 1 END,
+				last_failure_at = EXCLUDED.last_failure_at
+			RETURNING failures
+		`, key, now, now.Add(-throttleWindow)).Scan(&failures).Error; err != nil {
+			return lockouts, err
+		}
+
+		limit := throttleLimit(key)
+		if failures < limit {
+			continue
+		}
+
+		lockout := throttleBaseLockout
+		for i := limit; i < failures && lockout < throttleMaxLockout; i++ {
+			lockout *= 2
+		}
+		if lockout > throttleMaxLockout {
+			lockout = throttleMaxLockout
+		}
+
+		until := now.Add(lockout)
+		if err := s.DB.Model(&AuthThrottle{}).Where("throttle_key = ?", key).Update("locked_until", until).Error; err != nil {
+			return lockouts, err
+		}
+		lockouts = append(lockouts, Lockout{Key: key, Until: until})
+	}
+
+	return lockouts, nil
+}
+
+// ResetThrottle clears the counters after a successful attempt
+func (s *AuthService) ResetThrottle(keys ...string) error {
+	return s.DB.Where("throttle_key IN ?", keys).Delete(&AuthThrottle{}).Error
+}
+
+func (s *AuthService) DeleteStaleThrottles() error {
+	now := time.Now()
+	return s.DB.
+		Where("last_failure_at < ?", now.Add(-throttleWindow)).
+		Where("locked_until IS NULL OR locked_until < ?", now).
+		Delete(&AuthThrottle{}).Error
+}
+
+var (
+	ErrTwoFactorInvalidCode    = errors.New("invalid two-factor code")
+	ErrTwoFactorNotEnabled     = errors.New("two-factor authentication is not enabled")
+	ErrTwoFactorAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorRequired       = errors.New("two-factor authentication is required for your role")
+	ErrInvalidChallenge        = errors.New("login challenge is invalid or expired")
+)
+
+const (
+	totpIssuer           = "Nordik Drive"
+	recoveryCodeCount    = 10
+	loginChallengeTTL    = 5 * time.Minute
+	challengeTwoFactor   = "2fa"
+	challengeSetup       = "2fa_setup"
+	challengeVerifyEmail = "verify_email"
+	challengeOIDC        = "oidc_state"
+)
+
+func (s *AuthService) totpKey() string {
+	if s.CFG.TOTPKey != "" {
+		return s.CFG.TOTPKey
+	}
+	return s.CFG.JWTSecret
+}
+
+func (s *AuthService) getTOTP(userID int) (*UserTOTP, error) {
+	var totp UserTOTP
+	if err := s.DB.Where("user_id = ?", userID).First(&totp).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &totp, nil
+}
+
+func (s *AuthService) TwoFactorEnabled(userID int) (bool, error) {
+	totp, err := s.getTOTP(userID)
+	if err != nil {
+		return false, err
+	}
+	return totp != nil && totp.EnabledAt != nil, nil
+}
+
+// TwoFactorRequired reports whether any of the user's roles enforces 2FA
+func (s *AuthService) TwoFactorRequired(user *Auth) (bool, error) {
+	var count int64
+	err := s.DB.Model(&Role{}).
+		Where("require_two_factor = ?", true).
+		Where("role = ? OR role IN (SELECT role FROM user_roles WHERE user_id = ?)", user.Role, user.ID).
+		Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (s *AuthService) RemainingRecoveryCodes(userID int) (int64, error) {
+	var count int64
+	err := s.DB.Model(&RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", userID).Count(&count).Error
+	return count, err
+}
+
+// BeginTOTPSetup stores a new pending secret, replacing any unfinished enrolment
+func (s *AuthService) BeginTOTPSetup(user *Auth) (*TwoFactorSetupResponse, error) {
+	existing, err := s.getTOTP(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil && existing.EnabledAt != nil {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	secret, err := util.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := util.EncryptString(secret, s.totpKey())
+	if err != nil {
+		return nil, err
+	}
+
+	totp := UserTOTP{UserID: user.ID, Secret: encrypted}
+	if err := s.DB.Save(&totp).Error; err != nil {
+		return nil, err
+	}
+
+	return &TwoFactorSetupResponse{
+		Secret:          secret,
+		ProvisioningURI: util.TOTPProvisioningURI(totpIssuer, user.Email, secret),
+	}, nil
+}
+
+// ActivateTOTP confirms enrolment with a first valid code and returns fresh recovery codes
+func (s *AuthService) ActivateTOTP(userID int, code string) ([]string, error) {
+	totp, err := s.getTOTP(userID)
+	if err != nil {
+		return nil, err
+	}
+	if totp == nil {
+		return nil, errors.New("start two-factor setup first")
+	}
+	if totp.EnabledAt != nil {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	if err := s.checkTOTPCode(totp, code); err != nil {
+		return nil, err
+	}
+
+	var codes []string
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(totp).Update("enabled_at", time.Now()).Error; err != nil {
+			return err
+		}
+		var err error
+		codes, err = replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// VerifyTOTP checks a login code for a user with 2FA enabled
+func (s *AuthService) VerifyTOTP(userID int, code string) error {
+	totp, err := s.getTOTP(userID)
+	if err != nil {
+		return err
+	}
+	if totp == nil || totp.EnabledAt == nil {
+		return ErrTwoFactorNotEnabled
+	}
+	return s.checkTOTPCode(totp, code)
+}
+
+// checkTOTPCode validates the code and records its time step, so the same code
+// cannot be replayed while it is still within the validity window
+func (s *AuthService) checkTOTPCode(totp *UserTOTP, code string) error {
+	secret, err := util.DecryptString(totp.Secret, s.totpKey())
+	if err != nil {
+		return err
+	}
+
+	step, ok := util.ValidateTOTP(secret, code, time.Now())
+	if !ok {
+		return ErrTwoFactorInvalidCode
+	}
+
+	result := s.DB.Model(&UserTOTP{}).
+		Where("user_id = ? AND last_used_step < ?", totp.UserID, step).
+		Update("last_used_step", step)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrTwoFactorInvalidCode
+	}
+	return nil
+}
+
+// UseRecoveryCode consumes one unused recovery code
+func (s *AuthService) UseRecoveryCode(userID int, code string) error {
+	hash := util.HashToken(normalizeRecoveryCode(code))
+	result := s.DB.Model(&RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hash).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrTwoFactorInvalidCode
+	}
+	return nil
+}
+
+func (s *AuthService) RegenerateRecoveryCodes(userID int) ([]string, error) {
+	var codes []string
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		codes, err = replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	return codes, err
+}
+
+func (s *AuthService) DisableTOTP(user *Auth) error {
+	required, err := s.TwoFactorRequired(user)
+	if err != nil {
+		return err
+	}
+	if required {
+		return ErrTwoFactorRequired
+	}
+
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", user.ID).Delete(&UserTOTP{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", user.ID).Delete(&RecoveryCode{}).Error
+	})
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, userID int) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		secret, err := util.GenerateTOTPSecret()
+		if err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(secret[:5] + "-" + secret[5:10])
+		record := RecoveryCode{UserID: userID, CodeHash: util.HashToken(normalizeRecoveryCode(code))}
+		if err := tx.Create(&record).Error; err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+}
+
+// SignLoginChallenge issues the short-lived token that carries a half-finished
+// login between the password step and the two-factor step
+func (s *AuthService) SignLoginChallenge(userID int, purpose string, rememberMe bool) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id":     userID,
+		"purpose":     purpose,
+		"remember_me": rememberMe,
+		"exp":         time.Now().Add(loginChallengeTTL).Unix(),
+	})
+	return token.SignedString([]byte(s.CFG.JWTSecret))
+}
+
+func (s *AuthService) ParseLoginChallenge(tokenString, purpose string) (int, bool, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		return []byte(s.CFG.JWTSecret), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil || !token.Valid {
+		return 0, false, ErrInvalidChallenge
+	}
+
+	claims := token.Claims.(jwt.MapClaims)
+	if claims["purpose"] != purpose {
+		return 0, false, ErrInvalidChallenge
+	}
+	userID, ok := claims["user_id"].(float64)
+	if !ok {
+		return 0, false, ErrInvalidChallenge
+	}
+	rememberMe, _ := claims["remember_me"].(bool)
+
+	return int(userID), rememberMe, nil
+}
+
 // func (s *AuthService) GetAccessRequests(userID int) ([]AccessWithUser, error) {
 // 	var userRoles []UserRole
 // 	if err := s.DB.Where("user_id = ?", userID).Find(&userRoles).Error; err != nil {
@@ -1,13 +1,17 @@
 package chat
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"nordik-drive-api/internal/logs"
 
 	"github.com/gin-gonic/gin"
 )
 
 type ChatController struct {
 	ChatService *ChatService
+	LogService  *logs.LogService
 }
 
 func NewChatController(cs *ChatService) *ChatController {
@@ -15,6 +19,18 @@ func NewChatController(cs *ChatService) *ChatController {
 }
 
 func (cc *ChatController) Chat(c *gin.Context) {
+	userIDVal, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user ID not found"})
+		return
+	}
+
+	userID, ok := userIDVal.(float64)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user ID"})
+		return
+	}
+
 	question := c.PostForm("question")
 	filename := c.PostForm("filename")
 	audioFile, _ := c.FormFile("audio")
@@ -24,11 +40,27 @@ func (cc *ChatController) Chat(c *gin.Context) {
 		return
 	}
 
-	answer, err := cc.ChatService.Chat(question, audioFile, filename)
+	answer, err := cc.ChatService.Chat(question, audioFile, filename, uint(userID))
+	if errors.Is(err, ErrFileAccessDenied) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	// the question itself is not logged, it may quote the file's contents
+	if file, err := cc.ChatService.FileService.GetFileByName(filename); err == nil && file != nil {
+		cc.LogService.Record(c, logs.Event{
+			Service:    "chat",
+			Action:     logs.ActionChatFile,
+			Message:    fmt.Sprintf("Asked about file : %s", file.Filename),
+			TargetType: logs.TargetFile,
+			TargetID:   file.ID,
+			Metadata:   gin.H{"voice": audioFile != nil, "version": file.Version},
+		})
+	}
+
 	c.JSON(http.StatusOK, gin.H{"answer": answer})
 }
@@ -1,16 +1,17 @@
 package chat
 
 import (
+	"nordik-drive-api/internal/logs"
 	"nordik-drive-api/internal/middlewares"
 
 	"github.com/gin-gonic/gin"
 )
 
-func RegisterRoutes(r *gin.Engine, chatService *ChatService) {
-	chatController := &ChatController{ChatService: chatService}
+func RegisterRoutes(r *gin.Engine, chatService *ChatService, logService *logs.LogService) {
+	chatController := &ChatController{ChatService: chatService, LogService: logService}
 
 	userGroup := r.Group("/api/chat")
-	userGroup.Use(middlewares.AuthMiddleware())
+	userGroup.Use(middlewares.AuthMiddleware(middlewares.ScopeFileRead))
 	{
 		userGroup.POST("", chatController.Chat)
 	}
@@ -3,6 +3,7 @@ package chat
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
@@ -16,22 +17,48 @@ import (
 )
 
 type ChatService struct {
-	DB     *gorm.DB
-	APIKey string
+	DB          *gorm.DB
+	FileService *f.FileService
+	APIKey      string
 }
 
-func (cs *ChatService) Chat(question string, audioFile *multipart.FileHeader, filename string) (string, error) {
+var ErrFileAccessDenied = errors.New("you do not have access to this file")
+
+func (cs *ChatService) Chat(question string, audioFile *multipart.FileHeader, filename string, userID uint) (string, error) {
 	// Fetch latest file version
 	var file f.File
 	if err := cs.DB.Where("filename = ?", filename).Order("version DESC").First(&file).Error; err != nil {
 		return "", fmt.Errorf("file not found")
 	}
 
+	role, err := cs.FileService.GetUserRole(userID)
+	if err != nil {
+		return "", err
+	}
+	allowed, err := cs.FileService.CanAccessFile(userID, role, &file, f.AccessLevelView)
+	if err != nil {
+		return "", err
+	}
+	if !allowed {
+		return "", ErrFileAccessDenied
+	}
+
+	viewer, err := cs.FileService.GetViewer(userID)
+	if err != nil {
+		return "", err
+	}
+
 	var fileData []f.FileData
 	if err := cs.DB.Where("file_id = ? AND version = ?", file.ID, file.Version).Find(&fileData).Error; err != nil {
 		return "", fmt.Errorf("file data not found")
 	}
 
+	// only rows and columns the user may see go into the prompt
+	fileData, err = cs.FileService.ApplyPolicies(file.ID, viewer, fileData)
+	if err != nil {
+		return "", fmt.Errorf("failed to apply file policies: %w", err)
+	}
+
 	var allRows []json.RawMessage
 	for _, row := range fileData {
 		allRows = append(allRows, json.RawMessage(row.RowData))
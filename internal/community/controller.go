@@ -1,13 +1,16 @@
 package community
 
 import (
+	"fmt"
 	"net/http"
+	"nordik-drive-api/internal/logs"
 
 	"github.com/gin-gonic/gin"
 )
 
 type CommunityController struct {
 	CommunityService *CommunityService
+	LogService       *logs.LogService
 }
 
 func (cc *CommunityController) GetAllCommunities(c *gin.Context) {
@@ -22,3 +25,160 @@ func (cc *CommunityController) GetAllCommunities(c *gin.Context) {
 		"communities": communities,
 	})
 }
+
+func (cc *CommunityController) GetCommunity(c *gin.Context) {
+	community, err := cc.CommunityService.GetCommunityByID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if community == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "community not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "Community fetched successfully",
+		"community": community,
+	})
+}
+
+func (cc *CommunityController) CreateCommunity(c *gin.Context) {
+	_, ok := cc.requireAdmin(c)
+	if !ok {
+		return
+	}
+
+	var input CommunityInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	community, err := cc.CommunityService.CreateCommunity(input.Name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	cc.LogService.Record(c, logs.Event{
+		Service:    "community",
+		Action:     logs.ActionCreateCommunity,
+		Message:    fmt.Sprintf("Community created : %s", community.Name),
+		TargetType: logs.TargetCommunity,
+		TargetID:   uint(community.ID),
+		After:      community,
+	})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":   "Community created successfully",
+		"community": community,
+	})
+}
+
+func (cc *CommunityController) UpdateCommunity(c *gin.Context) {
+	_, ok := cc.requireAdmin(c)
+	if !ok {
+		return
+	}
+
+	var input CommunityInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	before, err := cc.CommunityService.GetCommunityByID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if before == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "community not found"})
+		return
+	}
+
+	community, err := cc.CommunityService.UpdateCommunity(c.Param("id"), input.Name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if community == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "community not found"})
+		return
+	}
+
+	cc.LogService.Record(c, logs.Event{
+		Service:    "community",
+		Action:     logs.ActionUpdateCommunity,
+		Message:    fmt.Sprintf("Community updated : %s", community.Name),
+		TargetType: logs.TargetCommunity,
+		TargetID:   uint(community.ID),
+		Before:     gin.H{"name": before.Name},
+		After:      gin.H{"name": community.Name},
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "Community updated successfully",
+		"community": community,
+	})
+}
+
+func (cc *CommunityController) DeleteCommunity(c *gin.Context) {
+	_, ok := cc.requireAdmin(c)
+	if !ok {
+		return
+	}
+
+	community, err := cc.CommunityService.DeleteCommunity(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if community == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "community not found"})
+		return
+	}
+
+	cc.LogService.Record(c, logs.Event{
+		Level:      logs.LevelWarn,
+		Service:    "community",
+		Action:     logs.ActionDeleteCommunity,
+		Message:    fmt.Sprintf("Community deleted : %s", community.Name),
+		TargetType: logs.TargetCommunity,
+		TargetID:   uint(community.ID),
+		Before:     community,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Community deleted successfully",
+	})
+}
+
+// requireAdmin writes the error response itself and returns false when the
+// caller is not allowed to manage communities.
+func (cc *CommunityController) requireAdmin(c *gin.Context) (uint, bool) {
+	userIDVal, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user ID not found"})
+		return 0, false
+	}
+
+	userID, ok := userIDVal.(float64)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user ID"})
+		return 0, false
+	}
+
+	role, err := cc.CommunityService.GetUserRole(uint(userID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return 0, false
+	}
+	if role != "Admin" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only admins can manage communities"})
+		return 0, false
+	}
+
+	return uint(userID), true
+}
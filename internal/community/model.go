@@ -11,6 +11,10 @@ type Community struct {
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
+type CommunityInput struct {
+	Name string `json:"name" binding:"required"`
+}
+
 func (Community) TableName() string {
 	return "community"
 }
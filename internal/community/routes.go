@@ -1,15 +1,23 @@
 package community
 
 import (
+	"nordik-drive-api/internal/logs"
+	"nordik-drive-api/internal/middlewares"
+
 	"github.com/gin-gonic/gin"
 )
 
-func RegisterRoutes(r *gin.Engine, communityService *CommunityService) {
-	communityController := &CommunityController{CommunityService: communityService}
+func RegisterRoutes(r *gin.Engine, communityService *CommunityService, logService *logs.LogService) {
+	communityController := &CommunityController{CommunityService: communityService, LogService: logService}
 
-	userGroup := r.Group("/communities")
+	userGroup := r.Group("/api/community")
+	userGroup.Use(middlewares.AuthMiddleware())
 	{
 		userGroup.GET("", communityController.GetAllCommunities)
+		userGroup.GET("/:id", communityController.GetCommunity)
+		userGroup.POST("", communityController.CreateCommunity)
+		userGroup.PUT("/:id", communityController.UpdateCommunity)
+		userGroup.DELETE("/:id", communityController.DeleteCommunity)
 	}
 
 }
@@ -1,6 +1,11 @@
 package community
 
 import (
+	"errors"
+	"nordik-drive-api/internal/auth"
+	"strings"
+	"time"
+
 	"gorm.io/gorm"
 )
 
@@ -8,11 +13,121 @@ type CommunityService struct {
 	DB *gorm.DB
 }
 
-func (fs *CommunityService) GetAllCommunities() ([]Community, error) {
-	var files []Community
-	result := fs.DB.Find(&files)
+func (cs *CommunityService) GetAllCommunities() ([]Community, error) {
+	var communities []Community
+	result := cs.DB.Order("community_name ASC").Find(&communities)
 	if result.Error != nil {
 		return nil, result.Error
 	}
-	return files, nil
+	return communities, nil
+}
+
+func (cs *CommunityService) GetCommunityByID(id string) (*Community, error) {
+	var community Community
+	if err := cs.DB.Where("id = ?", id).First(&community).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &community, nil
+}
+
+func (cs *CommunityService) CreateCommunity(name string) (*Community, error) {
+	community := Community{Name: strings.TrimSpace(name)}
+	if community.Name == "" {
+		return nil, errors.New("community name is required")
+	}
+
+	if err := cs.DB.Create(&community).Error; err != nil {
+		if strings.Contains(err.Error(), "duplicate key") || strings.Contains(err.Error(), "unique constraint") {
+			return nil, errors.New("a community with this name already exists")
+		}
+		return nil, err
+	}
+	return &community, nil
+}
+
+func (cs *CommunityService) UpdateCommunity(id string, name string) (*Community, error) {
+	community, err := cs.GetCommunityByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if community == nil {
+		return nil, nil
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, errors.New("community name is required")
+	}
+
+	oldName := community.Name
+	err = cs.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(community).Update("community_name", name).Error; err != nil {
+			return err
+		}
+
+		// memberships, invitations and row policies name the community
+		// rather than reference its id, so they follow the rename
+		if err := tx.Model(&auth.UserRole{}).
+			Where("community_name = ?", oldName).
+			Update("community_name", name).Error; err != nil {
+			return err
+		}
+		if err := tx.Table("user_invitations").
+			Where("community_name = ?", oldName).
+			Update("community_name", name).Error; err != nil {
+			return err
+		}
+		// row policies compare case-insensitively, see file.rowAllowed
+		return tx.Table("file_policy").
+			Where("policy_type = ? AND LOWER(TRIM(value)) = LOWER(?)", "row", oldName).
+			Update("value", name).Error
+	})
+	if err != nil {
+		if strings.Contains(err.Error(), "duplicate key") || strings.Contains(err.Error(), "unique constraint") {
+			return nil, errors.New("a community with this name already exists")
+		}
+		return nil, err
+	}
+
+	community.Name = name
+	return community, nil
+}
+
+func (cs *CommunityService) DeleteCommunity(id string) (*Community, error) {
+	community, err := cs.GetCommunityByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if community == nil {
+		return nil, nil
+	}
+
+	// file_community rows are removed by ON DELETE CASCADE; memberships and
+	// pending invitations only hold the name, so they are cleared here
+	err = cs.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(community).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("community_name = ?", community.Name).Delete(&auth.UserRole{}).Error; err != nil {
+			return err
+		}
+		return tx.Table("user_invitations").
+			Where("community_name = ? AND accepted_at IS NULL AND revoked_at IS NULL", community.Name).
+			Update("revoked_at", time.Now()).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return community, nil
+}
+
+func (cs *CommunityService) GetUserRole(userID uint) (string, error) {
+	var user auth.Auth
+	if err := cs.DB.First(&user, userID).Error; err != nil {
+		return "", err
+	}
+	return user.Role, nil
 }
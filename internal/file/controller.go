@@ -1,11 +1,13 @@
 package file
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"nordik-drive-api/internal/auth"
 	"nordik-drive-api/internal/logs"
 	"strconv"
-	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -68,10 +70,15 @@ func (fc *FileController) UploadFiles(c *gin.Context) {
 		return
 	}
 
-	uid := uint(userID)
-
-	if err := fc.LogService.Log("INFO", "file", "UPLOAD_FILE", fmt.Sprintf("File uploaded : %s", strings.Join(input.FileNames, "")), &uid, nil); err != nil {
-		fmt.Printf("Failed to insert log: %v\n", err)
+	for _, saved := range savedFiles {
+		fc.LogService.Record(c, logs.Event{
+			Service:    "file",
+			Action:     logs.ActionUploadFile,
+			Message:    fmt.Sprintf("File uploaded : %s", saved.Filename),
+			TargetType: logs.TargetFile,
+			TargetID:   saved.ID,
+			After:      gin.H{"version": saved.Version, "rows": saved.Rows, "private": saved.Private},
+		})
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "files uploaded successfully", "files": savedFiles})
@@ -102,7 +109,18 @@ func (fc *FileController) GetAllFiles(c *gin.Context) {
 		return
 	}
 
-	files, err := fc.FileService.GetAllFiles(userID, role)
+	var communityID *uint
+	if communityStr := c.Query("community_id"); communityStr != "" {
+		id, err := strconv.ParseUint(communityStr, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid community id"})
+			return
+		}
+		cid := uint(id)
+		communityID = &cid
+	}
+
+	files, err := fc.FileService.GetAllFiles(userID, role, communityID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -119,48 +137,137 @@ func (fc *FileController) GetAllFiles(c *gin.Context) {
 // }
 
 func (fc *FileController) GetFileData(c *gin.Context) {
+	_, file, fileData, ok := fc.loadVisibleRows(c, AccessLevelView)
+	if !ok {
+		return
+	}
+
+	fc.LogService.Record(c, logs.Event{
+		Service:    "file",
+		Action:     logs.ActionAccessFile,
+		Message:    fmt.Sprintf("File accessed : %s", file.Filename),
+		TargetType: logs.TargetFile,
+		TargetID:   file.ID,
+	})
+
+	c.JSON(http.StatusOK, fileData)
+}
+
+func (fc *FileController) SearchFileData(c *gin.Context) {
+	_, file, fileData, ok := fc.loadVisibleRows(c, AccessLevelView)
+	if !ok {
+		return
+	}
+
+	query := c.Query("q")
+	results, err := SearchRows(fileData, query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if results == nil {
+		results = []FileData{}
+	}
+
+	fc.LogService.Record(c, logs.Event{
+		Service:    "file",
+		Action:     logs.ActionSearchFile,
+		Message:    fmt.Sprintf("File searched : %s", file.Filename),
+		TargetType: logs.TargetFile,
+		TargetID:   file.ID,
+		Metadata:   gin.H{"query": query},
+	})
+
+	c.JSON(http.StatusOK, results)
+}
+
+func (fc *FileController) ExportFile(c *gin.Context) {
+	_, file, fileData, ok := fc.loadVisibleRows(c, AccessLevelExport)
+	if !ok {
+		return
+	}
+
+	fc.LogService.Record(c, logs.Event{
+		Service:    "file",
+		Action:     logs.ActionExportFile,
+		Message:    fmt.Sprintf("File exported : %s", file.Filename),
+		TargetType: logs.TargetFile,
+		TargetID:   file.ID,
+	})
+
+	c.Header("Content-Type", "text/csv")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", file.Filename+".csv"))
+	if err := WriteRowsCSV(c.Writer, fileData); err != nil {
+		fmt.Printf("Failed to write export: %v\n", err)
+	}
+}
+
+// loadVisibleRows reads the filename and version query parameters, checks the
+// caller's access level and returns the rows with the file's redaction
+// policies applied. It writes the error response itself on failure.
+func (fc *FileController) loadVisibleRows(c *gin.Context, level string) (uint, *File, []FileData, bool) {
 	userIDVal, exists := c.Get("userID")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "user ID not found"})
-		return
+		return 0, nil, nil, false
 	}
 
 	userID, ok := userIDVal.(float64)
 	if !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user ID"})
-		return
+		return 0, nil, nil, false
 	}
+	uid := uint(userID)
 
 	fileName := c.Query("filename")
 	versionStr := c.Query("version")
 	version, err := strconv.Atoi(versionStr)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid version"})
-		return
+		return 0, nil, nil, false
 	}
 
 	if fileName == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "file name is required"})
-		return
+		return 0, nil, nil, false
+	}
+
+	file, err := fc.FileService.GetFileByName(fileName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return 0, nil, nil, false
+	}
+	if file == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+		return 0, nil, nil, false
+	}
+	if !fc.authorizeFile(c, uid, file, level) {
+		return 0, nil, nil, false
 	}
 
 	fileData, err := fc.FileService.GetFileData(fileName, version)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+		return 0, nil, nil, false
 	}
 	if fileData == nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
-		return
+		return 0, nil, nil, false
 	}
 
-	uid := uint(userID)
+	viewer, err := fc.FileService.GetViewer(uid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return 0, nil, nil, false
+	}
 
-	if err := fc.LogService.Log("INFO", "file", "ACCESS_FILE", fmt.Sprintf("File accessed : %s", fileName), &uid, nil); err != nil {
-		fmt.Printf("Failed to insert log: %v\n", err)
+	fileData, err = fc.FileService.ApplyPolicies(file.ID, viewer, fileData)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return 0, nil, nil, false
 	}
 
-	c.JSON(http.StatusOK, fileData)
+	return uid, file, fileData, true
 }
 
 func (fc *FileController) DeleteFile(c *gin.Context) {
@@ -170,7 +277,7 @@ func (fc *FileController) DeleteFile(c *gin.Context) {
 		return
 	}
 
-	userID, ok := userIDVal.(float64)
+	_, ok := userIDVal.(float64)
 	if !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user ID"})
 		return
@@ -189,11 +296,16 @@ func (fc *FileController) DeleteFile(c *gin.Context) {
 		return
 	}
 
-	uid := uint(userID)
-
-	if err := fc.LogService.Log("WARN", "file", "DELETE_FILE", fmt.Sprintf("File deleted : %s", file.Filename), &uid, nil); err != nil {
-		fmt.Printf("Failed to insert log: %v\n", err)
-	}
+	fc.LogService.Record(c, logs.Event{
+		Level:      logs.LevelWarn,
+		Service:    "file",
+		Action:     logs.ActionDeleteFile,
+		Message:    fmt.Sprintf("File deleted : %s", file.Filename),
+		TargetType: logs.TargetFile,
+		TargetID:   file.ID,
+		Before:     gin.H{"is_delete": false},
+		After:      gin.H{"is_delete": true},
+	})
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "File deleted successfully",
@@ -207,7 +319,7 @@ func (fc *FileController) ResetFile(c *gin.Context) {
 		return
 	}
 
-	userID, ok := userIDVal.(float64)
+	_, ok := userIDVal.(float64)
 	if !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user ID"})
 		return
@@ -226,11 +338,15 @@ func (fc *FileController) ResetFile(c *gin.Context) {
 		return
 	}
 
-	uid := uint(userID)
-
-	if err := fc.LogService.Log("INFO", "file", "RESTORE_FILE", fmt.Sprintf("File restored : %s", file.Filename), &uid, nil); err != nil {
-		fmt.Printf("Failed to insert log: %v\n", err)
-	}
+	fc.LogService.Record(c, logs.Event{
+		Service:    "file",
+		Action:     logs.ActionRestoreFile,
+		Message:    fmt.Sprintf("File restored : %s", file.Filename),
+		TargetType: logs.TargetFile,
+		TargetID:   file.ID,
+		Before:     gin.H{"is_delete": true},
+		After:      gin.H{"is_delete": false},
+	})
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "File restored successfully",
@@ -250,23 +366,43 @@ func (fc *FileController) CreateAccess(c *gin.Context) {
 		return
 	}
 
-	var input []FileAccess
+	var input []FileAccessInput
 	if err := c.ShouldBind(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read data"})
 		return
 	}
 
-	if err := fc.FileService.CreateAccess(input); err != nil {
+	uid := uint(userID)
+
+	role, err := fc.FileService.GetUserRole(uid)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	uid := uint(userID)
+	grants, err := fc.FileService.CreateAccess(input, uid, role)
+	if err != nil {
+		if errors.Is(err, ErrNotFileOwner) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	if err := fc.LogService.Log("INFO", "file", "GRAND_FILE_ACCESS", "file access granted", &uid, nil); err != nil {
-		fmt.Printf("Failed to insert log: %v\n", err)
+	for _, grant := range grants {
+		fc.LogService.Record(c, logs.Event{
+			Service:    "file",
+			Action:     logs.ActionGrantFileAccess,
+			Message:    fmt.Sprintf("%s access to file %d granted", grant.AccessLevel, grant.FileID),
+			TargetType: logs.TargetFile,
+			TargetID:   grant.FileID,
+			After:      grant,
+		})
 	}
 
+	fc.FileService.NotifyAccessGranted(grants)
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "File access given successfully",
 	})
@@ -284,31 +420,56 @@ func (fc *FileController) DeleteAccess(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user ID"})
 		return
 	}
+	uid := uint(userID)
 
-	accessId := c.Query("id")
-
-	if err := fc.FileService.DeleteAccess(accessId); err != nil {
+	role, err := fc.FileService.GetUserRole(uid)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	uid := uint(userID)
+	accessId := c.Query("id")
 
-	if err := fc.LogService.Log("WARN", "file", "REVOKE_FILE_ACCESS", "file access revoked", &uid, nil); err != nil {
-		fmt.Printf("Failed to insert log: %v\n", err)
+	access, err := fc.FileService.DeleteAccess(accessId, uid, role)
+	if err != nil {
+		if errors.Is(err, ErrNotFileOwner) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
+	fc.LogService.Record(c, logs.Event{
+		Level:      logs.LevelWarn,
+		Service:    "file",
+		Action:     logs.ActionRevokeFileAccess,
+		Message:    fmt.Sprintf("%s access to file %d revoked", access.AccessLevel, access.FileID),
+		TargetType: logs.TargetFile,
+		TargetID:   access.FileID,
+		Before:     access,
+	})
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "File access revoked successfully",
 	})
 }
 
 type FileAccessWithUser struct {
-	ID        uint   `json:"id"`
-	UserID    uint   `json:"user_id"`
-	FileID    uint   `json:"file_id"`
-	FirstName string `json:"firstname" gorm:"column:firstname"`
-	LastName  string `json:"lastname" gorm:"column:lastname"`
+	ID                 uint       `json:"id"`
+	UserID             *uint      `json:"user_id,omitempty"`
+	GroupID            *uint      `json:"group_id,omitempty"`
+	FileID             uint       `json:"file_id"`
+	FirstName          string     `json:"firstname" gorm:"column:firstname"`
+	LastName           string     `json:"lastname" gorm:"column:lastname"`
+	GroupName          string     `json:"group_name" gorm:"column:group_name"`
+	AccessLevel        string     `json:"access_level"`
+	Reason             string     `json:"reason"`
+	GrantedBy          *uint      `json:"granted_by,omitempty"`
+	GrantedByFirstName string     `json:"granted_by_firstname" gorm:"column:granted_by_firstname"`
+	GrantedByLastName  string     `json:"granted_by_lastname" gorm:"column:granted_by_lastname"`
+	ExpiresAt          *time.Time `json:"expires_at,omitempty"`
+	CreatedAt          time.Time  `json:"created_at"`
 }
 
 func (fc *FileController) GetAllAccess(c *gin.Context) {
@@ -318,15 +479,23 @@ func (fc *FileController) GetAllAccess(c *gin.Context) {
 		return
 	}
 
-	_, ok := userIDVal.(float64)
+	userID, ok := userIDVal.(float64)
 	if !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user ID"})
 		return
 	}
 
-	fileId := c.Query("id")
+	file, ok := fc.fileFromQuery(c)
+	if !ok {
+		return
+	}
+	// grants name their users, groups and reasons, so only those who can
+	// change them may list them
+	if !fc.requireFileOwner(c, uint(userID), file) {
+		return
+	}
 
-	FileAccess, err := fc.FileService.GetFileAccess(fileId)
+	FileAccess, err := fc.FileService.GetFileAccess(strconv.FormatUint(uint64(file.ID), 10))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -349,15 +518,21 @@ func (fc *FileController) GetFileHistory(c *gin.Context) {
 		return
 	}
 
-	_, ok := userIDVal.(float64)
+	userID, ok := userIDVal.(float64)
 	if !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user ID"})
 		return
 	}
 
-	fileId := c.Query("id")
+	file, ok := fc.fileFromQuery(c)
+	if !ok {
+		return
+	}
+	if !fc.authorizeFile(c, uint(userID), file, AccessLevelView) {
+		return
+	}
 
-	fileHistory, err := fc.FileService.GetFileHistory(fileId)
+	fileHistory, err := fc.FileService.GetFileHistory(strconv.FormatUint(uint64(file.ID), 10))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -373,6 +548,69 @@ func (fc *FileController) GetFileHistory(c *gin.Context) {
 	})
 }
 
+// GET /api/file/:id/activity
+func (fc *FileController) GetFileActivity(c *gin.Context) {
+	userIDVal, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user ID not found"})
+		return
+	}
+
+	userID, ok := userIDVal.(float64)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user ID"})
+		return
+	}
+	uid := uint(userID)
+
+	var input logs.ActivityInput
+	if err := c.ShouldBindQuery(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	fileID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file ID"})
+		return
+	}
+
+	file, err := fc.FileService.GetFileByID(uint(fileID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+		return
+	}
+
+	role, err := fc.FileService.GetUserRole(uid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	allowed, err := fc.FileService.CanViewActivity(uid, role, file)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only the uploader, approvers or an admin can see file activity"})
+		return
+	}
+
+	activity, total, totalPages, err := fc.LogService.FileActivity(file.ID, input)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":        activity,
+		"page":        max(input.Page, 1),
+		"total":       total,
+		"total_pages": totalPages,
+	})
+}
+
 func (fc *FileController) ReplaceFile(c *gin.Context) {
 	userIDVal, exists := c.Get("userID")
 	if !exists {
@@ -398,17 +636,30 @@ func (fc *FileController) ReplaceFile(c *gin.Context) {
 		return
 	}
 
+	existing, err := fc.FileService.GetFileByID(replaceFileInput.Id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+		return
+	}
+	if !fc.authorizeFile(c, uint(userID), existing, AccessLevelEdit) {
+		return
+	}
+
 	err = fc.FileService.ReplaceFiles(file, replaceFileInput.Id, uint(userID))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	uid := uint(userID)
-
-	if err := fc.LogService.Log("INFO", "file", "REPLACE_FILE", fmt.Sprintf("File replaced: %s", file.Filename), &uid, nil); err != nil {
-		fmt.Printf("Failed to insert log: %v\n", err)
-	}
+	fc.LogService.Record(c, logs.Event{
+		Service:    "file",
+		Action:     logs.ActionReplaceFile,
+		Message:    fmt.Sprintf("File replaced: %s", existing.Filename),
+		TargetType: logs.TargetFile,
+		TargetID:   existing.ID,
+		Before:     gin.H{"version": existing.Version, "rows": existing.Rows},
+		Metadata:   gin.H{"upload": file.Filename},
+	})
 
 	c.JSON(http.StatusOK, gin.H{"message": "File replaced successfully"})
 }
@@ -431,19 +682,620 @@ func (fc *FileController) RevertFile(c *gin.Context) {
 		return
 	}
 
+	existing, err := fc.FileService.GetFileByName(input.Filename)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if existing == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+		return
+	}
+	if !fc.authorizeFile(c, uint(userID), existing, AccessLevelEdit) {
+		return
+	}
+
 	if err := fc.FileService.RevertFile(input.Filename, input.Version, uint(userID)); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	uid := uint(userID)
+	fc.LogService.Record(c, logs.Event{
+		Service:    "file",
+		Action:     logs.ActionRevertFile,
+		Message:    fmt.Sprintf("%s file reverted to %d version", input.Filename, input.Version),
+		TargetType: logs.TargetFile,
+		TargetID:   existing.ID,
+		Before:     gin.H{"version": existing.Version},
+		After:      gin.H{"version": input.Version},
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": fmt.Sprintf("file reverted to version %d successfully", input.Version),
+	})
+
+}
+
+func (fc *FileController) GetFileCommunities(c *gin.Context) {
+	userIDVal, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user ID not found"})
+		return
+	}
+
+	userID, ok := userIDVal.(float64)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user ID"})
+		return
+	}
+
+	file, ok := fc.fileFromQuery(c)
+	if !ok {
+		return
+	}
+	if !fc.authorizeFile(c, uint(userID), file, AccessLevelView) {
+		return
+	}
 
-	if err := fc.LogService.Log("INFO", "file", "REVERT_FILE", fmt.Sprintf("%s file reverted to %d version", input.Filename, input.Version), &uid, nil); err != nil {
-		fmt.Printf("Failed to insert log: %v\n", err)
+	communities, err := fc.FileService.GetFileCommunities(strconv.FormatUint(uint64(file.ID), 10))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"message": fmt.Sprintf("file reverted to version %d successfully", input.Version),
+		"message":     "File communities fetched successfully",
+		"communities": communities,
+	})
+}
+
+func (fc *FileController) SetFileCommunities(c *gin.Context) {
+	userIDVal, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user ID not found"})
+		return
+	}
+
+	userID, ok := userIDVal.(float64)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user ID"})
+		return
+	}
+
+	var input FileCommunityInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	role, err := fc.FileService.GetUserRole(uint(userID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	existing, err := fc.FileService.GetFileByID(input.FileID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+		return
+	}
+	if role != "Admin" && existing.InsertedBy != uint(userID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only the uploader or an admin can change file communities"})
+		return
+	}
+
+	before, err := fc.FileService.GetFileCommunities(strconv.FormatUint(uint64(input.FileID), 10))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	beforeIDs := make([]uint, 0, len(before))
+	for _, community := range before {
+		beforeIDs = append(beforeIDs, community.CommunityID)
+	}
+
+	file, err := fc.FileService.SetFileCommunities(input)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	fc.LogService.Record(c, logs.Event{
+		Service:    "file",
+		Action:     logs.ActionUpdateFileCommunities,
+		Message:    fmt.Sprintf("File communities updated : %s", file.Filename),
+		TargetType: logs.TargetFile,
+		TargetID:   file.ID,
+		Before:     gin.H{"community_ids": beforeIDs},
+		After:      gin.H{"community_ids": input.CommunityIDs},
 	})
 
+	c.JSON(http.StatusOK, gin.H{
+		"message": "File communities updated successfully",
+	})
+}
+
+// fileFromQuery loads the file named by the "id" query parameter. It writes
+// the error response itself and returns false when there is no such file.
+func (fc *FileController) fileFromQuery(c *gin.Context) (*File, bool) {
+	fileId := c.Query("id")
+	if fileId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file ID is required"})
+		return nil, false
+	}
+
+	id, err := strconv.ParseUint(fileId, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file ID"})
+		return nil, false
+	}
+
+	file, err := fc.FileService.GetFileByID(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+		return nil, false
+	}
+	return file, true
+}
+
+// authorizeFile writes the error response itself and returns false when the
+// user lacks the requested access level on the file.
+func (fc *FileController) authorizeFile(c *gin.Context, userID uint, file *File, level string) bool {
+	role, err := fc.FileService.GetUserRole(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+
+	allowed, err := fc.FileService.CanAccessFile(userID, role, file, level)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "you do not have access to this file"})
+		return false
+	}
+
+	return true
+}
+
+func (fc *FileController) CreateShareLink(c *gin.Context) {
+	userIDVal, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user ID not found"})
+		return
+	}
+
+	userID, ok := userIDVal.(float64)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user ID"})
+		return
+	}
+
+	var input ShareLinkInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	file, err := fc.FileService.GetFileByID(input.FileID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+		return
+	}
+	if !fc.requireFileOwner(c, uint(userID), file) {
+		return
+	}
+
+	link, err := fc.FileService.CreateShareLink(input, uint(userID))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	token, err := SignShareToken(link, fc.FileService.CFG.JWTSecret)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	fc.LogService.Record(c, logs.Event{
+		Service:    "file",
+		Action:     logs.ActionCreateShareLink,
+		Message:    fmt.Sprintf("Share link %d created for %s version %d", link.ID, file.Filename, link.Version),
+		TargetType: logs.TargetFile,
+		TargetID:   file.ID,
+		Metadata:   gin.H{"link_id": link.ID, "version": link.Version},
+	})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Share link created successfully",
+		"link":    ShareLinkResponse{FileShareLink: *link, HasPassword: link.PasswordHash != nil},
+		"token":   token,
+		"path":    "/api/share/" + token,
+	})
+}
+
+func (fc *FileController) GetShareLinks(c *gin.Context) {
+	userIDVal, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user ID not found"})
+		return
+	}
+
+	userID, ok := userIDVal.(float64)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user ID"})
+		return
+	}
+
+	fileId, err := strconv.ParseUint(c.Query("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file id"})
+		return
+	}
+
+	file, err := fc.FileService.GetFileByID(uint(fileId))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+		return
+	}
+	if !fc.requireFileOwner(c, uint(userID), file) {
+		return
+	}
+
+	links, err := fc.FileService.GetShareLinks(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Share links fetched successfully",
+		"links":   links,
+	})
+}
+
+func (fc *FileController) RevokeShareLink(c *gin.Context) {
+	userIDVal, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user ID not found"})
+		return
+	}
+
+	userID, ok := userIDVal.(float64)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user ID"})
+		return
+	}
+
+	link, err := fc.FileService.GetShareLinkByID(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "share link not found"})
+		return
+	}
+
+	file, err := fc.FileService.GetFileByID(link.FileID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+		return
+	}
+	if !fc.requireFileOwner(c, uint(userID), file) {
+		return
+	}
+
+	if err := fc.FileService.RevokeShareLink(link); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	fc.LogService.Record(c, logs.Event{
+		Level:      logs.LevelWarn,
+		Service:    "file",
+		Action:     logs.ActionRevokeShareLink,
+		Message:    fmt.Sprintf("Share link %d revoked for %s", link.ID, file.Filename),
+		TargetType: logs.TargetFile,
+		TargetID:   file.ID,
+		Metadata:   gin.H{"link_id": link.ID},
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Share link revoked successfully",
+	})
+}
+
+// ViewSharedFile serves the rows behind a share link without authentication.
+// The optional password is read from the X-Share-Password header.
+func (fc *FileController) ViewSharedFile(c *gin.Context) {
+	link, fileData, ok := fc.resolveShareLink(c, logs.ActionShareLinkView)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"file_id": link.FileID,
+		"version": link.Version,
+		"rows":    fileData,
+	})
+}
+
+func (fc *FileController) DownloadSharedFile(c *gin.Context) {
+	link, fileData, ok := fc.resolveShareLink(c, logs.ActionShareLinkDownload)
+	if !ok {
+		return
+	}
+
+	file, err := fc.FileService.GetFileByID(link.FileID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+		return
+	}
+
+	c.Header("Content-Type", "text/csv")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("%s_v%d.csv", file.Filename, link.Version)))
+	if err := WriteRowsCSV(c.Writer, fileData); err != nil {
+		fmt.Printf("Failed to write shared file: %v\n", err)
+	}
+}
+
+func (fc *FileController) resolveShareLink(c *gin.Context, action logs.Action) (*FileShareLink, []FileData, bool) {
+	linkID, err := ParseShareToken(c.Param("token"), fc.FileService.CFG.JWTSecret)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return nil, nil, false
+	}
+
+	// the token is public, so guesses are limited per link as well as per IP
+	password := c.GetHeader("X-Share-Password")
+	linkKey := auth.AccountThrottleKey("share-link", strconv.FormatUint(uint64(linkID), 10))
+	ipKey := auth.IPThrottleKey("share-link", c.ClientIP())
+	if fc.throttled(c, linkKey, ipKey) {
+		return nil, nil, false
+	}
+
+	link, err := fc.FileService.UseShareLink(linkID, password)
+	if err != nil {
+		status := http.StatusNotFound
+		if errors.Is(err, ErrShareLinkPassword) {
+			status = http.StatusUnauthorized
+			// a missing password is how clients learn one is needed
+			if password != "" {
+				fc.recordShareLinkFailure(c, linkKey, ipKey)
+			}
+		}
+		fc.LogService.Record(c, logs.Event{
+			Level:    logs.LevelWarn,
+			Service:  "file",
+			Action:   logs.ActionShareLinkDenied,
+			Message:  fmt.Sprintf("Share link %d rejected: %s", linkID, err.Error()),
+			Metadata: gin.H{"link_id": linkID},
+		})
+		c.JSON(status, gin.H{"error": err.Error()})
+		return nil, nil, false
+	}
+
+	if password != "" {
+		if err := fc.FileService.Auth.ResetThrottle(linkKey); err != nil {
+			fmt.Printf("Failed to reset share link throttle: %v\n", err)
+		}
+	}
+
+	fileData, err := fc.FileService.GetFileDataByID(link.FileID, link.Version)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, nil, false
+	}
+
+	// partners viewing through a link have no roles or communities
+	fileData, err = fc.FileService.ApplyPolicies(link.FileID, Viewer{}, fileData)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, nil, false
+	}
+
+	fc.LogService.Record(c, logs.Event{
+		Service:    "file",
+		Action:     action,
+		Message:    fmt.Sprintf("Share link %d used for file %d version %d", link.ID, link.FileID, link.Version),
+		TargetType: logs.TargetFile,
+		TargetID:   link.FileID,
+		Metadata:   gin.H{"link_id": link.ID, "version": link.Version, "use_count": link.UseCount},
+	})
+
+	return link, fileData, true
+}
+
+// throttled writes a 429 with Retry-After and returns true while any of the
+// keys is locked
+func (fc *FileController) throttled(c *gin.Context, keys ...string) bool {
+	err := fc.FileService.Auth.CheckThrottle(keys...)
+
+	var locked *auth.ThrottleLockedError
+	if errors.As(err, &locked) {
+		c.Header("Retry-After", strconv.Itoa(int(locked.RetryAfter.Seconds())+1))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": locked.Error()})
+		return true
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return true
+	}
+	return false
+}
+
+// recordShareLinkFailure counts a wrong share link password and writes a WARN
+// log for every lockout it causes
+func (fc *FileController) recordShareLinkFailure(c *gin.Context, keys ...string) {
+	lockouts, err := fc.FileService.Auth.RecordFailure(keys...)
+	if err != nil {
+		fmt.Printf("Failed to record failed attempt: %v\n", err)
+	}
+
+	for _, l := range lockouts {
+		fc.LogService.Record(c, logs.Event{
+			Level:    logs.LevelWarn,
+			Service:  "file",
+			Action:   logs.ActionLockout,
+			Message:  fmt.Sprintf("Locked %s until %s", l.Key, l.Until.Format(time.RFC3339)),
+			Metadata: gin.H{"key": l.Key, "locked_until": l.Until},
+		})
+	}
+}
+
+// requireFileOwner writes the error response itself and returns false unless
+// the user uploaded the file or is an admin.
+func (fc *FileController) requireFileOwner(c *gin.Context, userID uint, file *File) bool {
+	if file.InsertedBy == userID {
+		return true
+	}
+
+	role, err := fc.FileService.GetUserRole(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	if role != "Admin" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only the file owner or an admin can do this"})
+		return false
+	}
+
+	return true
+}
+
+func (fc *FileController) GetPolicies(c *gin.Context) {
+	userIDVal, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user ID not found"})
+		return
+	}
+
+	userID, ok := userIDVal.(float64)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user ID"})
+		return
+	}
+
+	fileId, err := strconv.ParseUint(c.Query("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file id"})
+		return
+	}
+
+	file, err := fc.FileService.GetFileByID(uint(fileId))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+		return
+	}
+	if !fc.requireFileOwner(c, uint(userID), file) {
+		return
+	}
+
+	policies, err := fc.FileService.GetPolicies(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Policies fetched successfully",
+		"policies": policies,
+	})
+}
+
+func (fc *FileController) CreatePolicy(c *gin.Context) {
+	userIDVal, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user ID not found"})
+		return
+	}
+
+	userID, ok := userIDVal.(float64)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user ID"})
+		return
+	}
+
+	var input FilePolicyInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	file, err := fc.FileService.GetFileByID(input.FileID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+		return
+	}
+	if !fc.requireFileOwner(c, uint(userID), file) {
+		return
+	}
+
+	policy, err := fc.FileService.CreatePolicy(input, uint(userID))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	fc.LogService.Record(c, logs.Event{
+		Service:    "file",
+		Action:     logs.ActionCreateFilePolicy,
+		Message:    fmt.Sprintf("%s policy on column %s added to %s", policy.PolicyType, policy.ColumnName, file.Filename),
+		TargetType: logs.TargetFile,
+		TargetID:   file.ID,
+		After:      policy,
+	})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Policy created successfully",
+		"policy":  policy,
+	})
+}
+
+func (fc *FileController) DeletePolicy(c *gin.Context) {
+	userIDVal, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user ID not found"})
+		return
+	}
+
+	userID, ok := userIDVal.(float64)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user ID"})
+		return
+	}
+
+	policy, err := fc.FileService.GetPolicyByID(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "policy not found"})
+		return
+	}
+
+	file, err := fc.FileService.GetFileByID(policy.FileID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+		return
+	}
+	if !fc.requireFileOwner(c, uint(userID), file) {
+		return
+	}
+
+	if err := fc.FileService.DeletePolicy(policy); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	fc.LogService.Record(c, logs.Event{
+		Level:      logs.LevelWarn,
+		Service:    "file",
+		Action:     logs.ActionDeleteFilePolicy,
+		Message:    fmt.Sprintf("%s policy on column %s removed from %s", policy.PolicyType, policy.ColumnName, file.Filename),
+		TargetType: logs.TargetFile,
+		TargetID:   file.ID,
+		Before:     policy,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Policy deleted successfully",
+	})
 }
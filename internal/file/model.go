@@ -54,10 +54,123 @@ type FileData struct {
 	Version    int            `json:"version"`
 }
 
+const (
+	AccessLevelView   = "view"
+	AccessLevelExport = "export"
+	AccessLevelEdit   = "edit"
+)
+
+// accessLevelRank orders access levels so a higher grant satisfies a lower requirement
+var accessLevelRank = map[string]int{
+	AccessLevelView:   1,
+	AccessLevelExport: 2,
+	AccessLevelEdit:   3,
+}
+
 type FileAccess struct {
-	ID     uint `gorm:"primaryKey" json:"id"`
-	UserID uint `gorm:"type:json" json:"user_id"`
-	FileID uint `gorm:"not null;index" json:"file_id"`
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	UserID      *uint      `gorm:"index" json:"user_id,omitempty"`
+	GroupID     *uint      `gorm:"index" json:"group_id,omitempty"`
+	FileID      uint       `gorm:"not null;index" json:"file_id"`
+	AccessLevel string     `gorm:"size:20;not null;default:view" json:"access_level"`
+	Reason      string     `gorm:"type:text" json:"reason"`
+	GrantedBy   *uint      `json:"granted_by,omitempty"`
+	ExpiresAt   *time.Time `gorm:"index" json:"expires_at,omitempty"`
+	CreatedAt   time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// FileAccessInput targets either a single user or a user group
+type FileAccessInput struct {
+	UserID        *uint      `json:"user_id"`
+	GroupID       *uint      `json:"group_id"`
+	FileID        uint       `json:"file_id" binding:"required"`
+	AccessLevel   string     `json:"access_level"`
+	Reason        string     `json:"reason"`
+	ExpiresAt     *time.Time `json:"expires_at"`
+	ExpiresInDays *int       `json:"expires_in_days"`
+}
+
+// FileCommunity tags a file with a community for filtering. It does not
+// grant access; private files still need a file_access grant.
+type FileCommunity struct {
+	ID          uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	FileID      uint      `gorm:"not null;index" json:"file_id"`
+	CommunityID uint      `gorm:"not null;index" json:"community_id"`
+	CreatedAt   time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+type FileCommunityWithName struct {
+	FileID        uint   `json:"file_id"`
+	CommunityID   uint   `json:"community_id"`
+	CommunityName string `json:"community_name" gorm:"column:community_name"`
+}
+
+type FileCommunityInput struct {
+	FileID       uint   `json:"file_id" binding:"required"`
+	CommunityIDs []uint `json:"community_ids"`
+}
+
+type FileShareLink struct {
+	ID           uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	FileID       uint       `gorm:"not null;index" json:"file_id"`
+	Version      int        `gorm:"not null" json:"version"`
+	PasswordHash *string    `json:"-"`
+	ExpiresAt    time.Time  `gorm:"not null" json:"expires_at"`
+	MaxUses      *int       `json:"max_uses,omitempty"`
+	UseCount     int        `gorm:"not null;default:0" json:"use_count"`
+	LastUsedAt   *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty"`
+	CreatedBy    uint       `gorm:"not null" json:"created_by"`
+	CreatedAt    time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+type ShareLinkInput struct {
+	FileID         uint   `json:"file_id" binding:"required"`
+	Version        int    `json:"version"`
+	ExpiresInHours int    `json:"expires_in_hours" binding:"required,min=1,max=720"`
+	Password       string `json:"password"`
+	MaxUses        *int   `json:"max_uses"`
+}
+
+type ShareLinkResponse struct {
+	FileShareLink
+	HasPassword bool `json:"has_password"`
+}
+
+const (
+	PolicyTypeColumn = "column"
+	PolicyTypeRow    = "row"
+
+	PolicyActionHide      = "hide"
+	PolicyActionMask      = "mask"
+	PolicyActionEquals    = "equals"
+	PolicyActionNotEquals = "not_equals"
+
+	// PolicyValueUserCommunity in a row filter matches any community the viewer belongs to
+	PolicyValueUserCommunity = "$user_community"
+)
+
+// FilePolicy hides or masks a column, or filters rows on a column value, for
+// every viewer whose roles are not listed in ExemptRoles
+type FilePolicy struct {
+	ID          uint                        `gorm:"primaryKey;autoIncrement" json:"id"`
+	FileID      uint                        `gorm:"not null;index" json:"file_id"`
+	PolicyType  string                      `gorm:"size:20;not null" json:"policy_type"`
+	ColumnName  string                      `gorm:"size:255;not null" json:"column_name"`
+	Action      string                      `gorm:"size:20;not null" json:"action"`
+	Value       string                      `gorm:"type:text" json:"value"`
+	ExemptRoles datatypes.JSONSlice[string] `gorm:"type:jsonb" json:"exempt_roles"`
+	CreatedBy   uint                        `gorm:"not null" json:"created_by"`
+	CreatedAt   time.Time                   `gorm:"autoCreateTime" json:"created_at"`
+}
+
+type FilePolicyInput struct {
+	FileID      uint     `json:"file_id" binding:"required"`
+	PolicyType  string   `json:"policy_type" binding:"required,oneof=column row"`
+	ColumnName  string   `json:"column_name" binding:"required"`
+	Action      string   `json:"action" binding:"required,oneof=hide mask equals not_equals"`
+	Value       string   `json:"value"`
+	ExemptRoles []string `json:"exempt_roles"`
 }
 
 type RevertFileInput struct {
@@ -67,8 +180,9 @@ type RevertFileInput struct {
 
 type FileWithUser struct {
 	File
-	Firstname string `json:"firstname"`
-	Lastname  string `json:"lastname"`
+	Firstname   string   `json:"firstname"`
+	Lastname    string   `json:"lastname"`
+	Communities []string `gorm:"-" json:"communities"`
 }
 
 func (File) TableName() string {
@@ -86,3 +200,15 @@ func (FileAccess) TableName() string {
 func (FileVersion) TableName() string {
 	return "file_version"
 }
+
+func (FilePolicy) TableName() string {
+	return "file_policy"
+}
+
+func (FileShareLink) TableName() string {
+	return "file_share_link"
+}
+
+func (FileCommunity) TableName() string {
+	return "file_community"
+}
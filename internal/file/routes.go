@@ -10,20 +10,42 @@ import (
 func RegisterRoutes(r *gin.Engine, fileService *FileService, logService *logs.LogService) {
 	fileController := &FileController{FileService: fileService, LogService: logService}
 
+	read := middlewares.AuthMiddleware(middlewares.ScopeFileRead)
+	export := middlewares.AuthMiddleware(middlewares.ScopeFileExport)
+	upload := middlewares.AuthMiddleware(middlewares.ScopeFileUpload)
+	manage := middlewares.AuthMiddleware(middlewares.ScopeFileManage)
+
 	userGroup := r.Group("/api/file")
-	userGroup.Use(middlewares.AuthMiddleware())
 	{
-		userGroup.GET("", fileController.GetAllFiles)
-		userGroup.POST("/upload", fileController.UploadFiles)
-		userGroup.GET("/data", fileController.GetFileData)
-		userGroup.DELETE("", fileController.DeleteFile)
-		userGroup.PUT("/reset", fileController.ResetFile)
-		userGroup.GET("/access", fileController.GetAllAccess)
-		userGroup.POST("/access", fileController.CreateAccess)
-		userGroup.DELETE("/access", fileController.DeleteAccess)
-		userGroup.GET("/history", fileController.GetFileHistory)
-		userGroup.POST("/replace", fileController.ReplaceFile)
-		userGroup.POST("/revert", fileController.RevertFile)
+		userGroup.GET("", read, fileController.GetAllFiles)
+		userGroup.POST("/upload", upload, fileController.UploadFiles)
+		userGroup.GET("/data", read, fileController.GetFileData)
+		userGroup.GET("/search", read, fileController.SearchFileData)
+		userGroup.GET("/export", export, fileController.ExportFile)
+		userGroup.DELETE("", manage, fileController.DeleteFile)
+		userGroup.PUT("/reset", manage, fileController.ResetFile)
+		userGroup.GET("/access", read, fileController.GetAllAccess)
+		userGroup.POST("/access", manage, fileController.CreateAccess)
+		userGroup.DELETE("/access", manage, fileController.DeleteAccess)
+		userGroup.GET("/history", read, fileController.GetFileHistory)
+		userGroup.GET("/:id/activity", read, fileController.GetFileActivity)
+		userGroup.POST("/replace", upload, fileController.ReplaceFile)
+		userGroup.POST("/revert", upload, fileController.RevertFile)
+		userGroup.GET("/community", read, fileController.GetFileCommunities)
+		userGroup.PUT("/community", manage, fileController.SetFileCommunities)
+		userGroup.GET("/share", manage, fileController.GetShareLinks)
+		userGroup.POST("/share", manage, fileController.CreateShareLink)
+		userGroup.DELETE("/share", manage, fileController.RevokeShareLink)
+		userGroup.GET("/policy", manage, fileController.GetPolicies)
+		userGroup.POST("/policy", manage, fileController.CreatePolicy)
+		userGroup.DELETE("/policy", manage, fileController.DeletePolicy)
+	}
+
+	// share links are used by unauthenticated partners
+	shareGroup := r.Group("/api/share")
+	{
+		shareGroup.GET("/:token", fileController.ViewSharedFile)
+		shareGroup.GET("/:token/download", fileController.DownloadSharedFile)
 	}
 
 }
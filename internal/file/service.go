@@ -6,18 +6,29 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"log"
 	"mime/multipart"
+	"nordik-drive-api/config"
 	"nordik-drive-api/internal/auth"
+	"nordik-drive-api/internal/mailer"
+	"nordik-drive-api/internal/util"
 	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/iancoleman/orderedmap"
 	"github.com/xuri/excelize/v2"
 	"gorm.io/gorm"
 )
 
 type FileService struct {
-	DB *gorm.DB
+	DB     *gorm.DB
+	CFG    *config.Config
+	Mailer mailer.Mailer
+	// Auth throttles share link password attempts
+	Auth *auth.AuthService
 }
 
 func (fs *FileService) SaveFilesMultipart(uploadedFiles []*multipart.FileHeader, filenames FileUploadInput, userID uint) ([]File, error) {
@@ -255,37 +266,149 @@ func (fs *FileService) GetUserRole(userID uint) (string, error) {
 	return user.Role, nil
 }
 
-func (fs *FileService) GetAllFiles(userID uint, role string) ([]FileWithUser, error) {
+func (fs *FileService) GetFileByID(fileID uint) (*File, error) {
+	var file File
+	if err := fs.DB.First(&file, fileID).Error; err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+func (fs *FileService) GetAllFiles(userID uint, role string, communityID *uint) ([]FileWithUser, error) {
 	var files []FileWithUser
 
-	if role == "Admin" {
-		// Admin → all files with uploader info
-		if err := fs.DB.
-			Table("file f").
-			Select("f.*, u.firstname, u.lastname").
-			Joins("LEFT JOIN users u ON u.id = f.inserted_by").
-			Scan(&files).Error; err != nil {
-			return nil, err
+	query := fs.DB.
+		Table("file f").
+		Select("f.*, u.firstname, u.lastname").
+		Joins("LEFT JOIN users u ON u.id = f.inserted_by")
+
+	if role != "Admin" {
+		// User → public files, or private files granted to them or one of
+		// their groups
+		query = query.
+			Where(`(f.private = false OR (f.is_delete = false AND EXISTS (
+				SELECT 1 FROM file_access fa
+				WHERE fa.file_id = f.id
+				AND (fa.user_id = ? OR fa.group_id IN (SELECT gm.group_id FROM user_group_members gm WHERE gm.user_id = ?))
+				AND (fa.expires_at IS NULL OR fa.expires_at > ?)
+			)))`, userID, userID, time.Now())
+	}
+
+	if communityID != nil {
+		query = query.Where("EXISTS (SELECT 1 FROM file_community fc WHERE fc.file_id = f.id AND fc.community_id = ?)", *communityID)
+	}
+
+	if err := query.Scan(&files).Error; err != nil {
+		return nil, err
+	}
+
+	if err := fs.attachCommunities(files); err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+// attachCommunities fills in the community names linked to each file
+func (fs *FileService) attachCommunities(files []FileWithUser) error {
+	if len(files) == 0 {
+		return nil
+	}
+
+	fileIDs := make([]uint, 0, len(files))
+	for _, f := range files {
+		fileIDs = append(fileIDs, f.ID)
+	}
+
+	var links []FileCommunityWithName
+	if err := fs.DB.Table("file_community fc").
+		Select("fc.file_id, fc.community_id, c.community_name").
+		Joins("JOIN community c ON c.id = fc.community_id").
+		Where("fc.file_id IN ?", fileIDs).
+		Order("c.community_name ASC").
+		Scan(&links).Error; err != nil {
+		return err
+	}
+
+	grouped := map[uint][]string{}
+	for _, l := range links {
+		grouped[l.FileID] = append(grouped[l.FileID], l.CommunityName)
+	}
+
+	for i := range files {
+		files[i].Communities = grouped[files[i].ID]
+		if files[i].Communities == nil {
+			files[i].Communities = []string{}
 		}
-		return files, nil
 	}
 
-	// User → public files OR private files they have access to
-	err := fs.DB.
-		Raw(`
-			SELECT f.*, u.firstname, u.lastname
-			FROM file f
-			LEFT JOIN users u ON u.id = f.inserted_by
-			LEFT JOIN file_access fa ON f.id = fa.file_id AND fa.user_id = ?
-			WHERE f.private = false OR (fa.user_id = ? AND f.is_delete = ?)
-		`, userID, userID, false).
-		Scan(&files).Error
+	return nil
+}
+
+func (fs *FileService) GetFileCommunities(fileId string) ([]FileCommunityWithName, error) {
+	var results []FileCommunityWithName
+
+	err := fs.DB.Table("file_community fc").
+		Select("fc.file_id, fc.community_id, c.community_name").
+		Joins("JOIN community c ON c.id = fc.community_id").
+		Where("fc.file_id = ?", fileId).
+		Order("c.community_name ASC").
+		Scan(&results).Error
 
 	if err != nil {
 		return nil, err
 	}
 
-	return files, nil
+	return results, nil
+}
+
+// SetFileCommunities replaces the communities linked to a file
+func (fs *FileService) SetFileCommunities(input FileCommunityInput) (File, error) {
+	var file File
+	if err := fs.DB.First(&file, input.FileID).Error; err != nil {
+		return file, fmt.Errorf("file not found: %w", err)
+	}
+
+	err := fs.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("file_id = ?", file.ID).Delete(&FileCommunity{}).Error; err != nil {
+			return err
+		}
+
+		seen := map[uint]bool{}
+		for _, communityID := range input.CommunityIDs {
+			if seen[communityID] {
+				continue
+			}
+			seen[communityID] = true
+
+			var count int64
+			if err := tx.Table("community").Where("id = ?", communityID).Count(&count).Error; err != nil {
+				return err
+			}
+			if count == 0 {
+				return fmt.Errorf("community %d not found", communityID)
+			}
+
+			link := FileCommunity{FileID: file.ID, CommunityID: communityID}
+			if err := tx.Create(&link).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	return file, err
+}
+
+func (fs *FileService) GetFileByName(filename string) (*File, error) {
+	var file File
+	if err := fs.DB.Where("filename = ? AND is_delete = ?", filename, false).First(&file).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &file, nil
 }
 
 func (fs *FileService) GetFileData(filename string, version int) ([]FileData, error) {
@@ -357,35 +480,166 @@ func parseCSVReader(file multipart.File) ([]string, [][]string, error) {
 	return headers, dataRows, nil
 }
 
-func (fs *FileService) CreateAccess(input []FileAccess) error {
-	if err := fs.DB.Create(&input).Error; err != nil {
+var ErrNotFileOwner = errors.New("only the uploader or an admin can manage access to this file")
+
+// canManageAccess returns ErrNotFileOwner unless the user uploaded the file
+// or is an admin
+func (fs *FileService) canManageAccess(fileID, userID uint, role string) error {
+	file, err := fs.GetFileByID(fileID)
+	if err != nil {
 		return err
 	}
+	if role != "Admin" && file.InsertedBy != userID {
+		return ErrNotFileOwner
+	}
 	return nil
 }
 
-func (fs *FileService) DeleteAccess(accessId string) error {
+func (fs *FileService) CreateAccess(input []FileAccessInput, grantedBy uint, role string) ([]FileAccess, error) {
+	grants := make([]FileAccess, 0, len(input))
+	for _, in := range input {
+		if (in.UserID == nil) == (in.GroupID == nil) {
+			return nil, errors.New("each grant needs exactly one of user_id or group_id")
+		}
+		if err := fs.canManageAccess(in.FileID, grantedBy, role); err != nil {
+			return nil, err
+		}
+
+		level := in.AccessLevel
+		if level == "" {
+			level = AccessLevelView
+		}
+		if _, ok := accessLevelRank[level]; !ok {
+			return nil, fmt.Errorf("invalid access level: %s", level)
+		}
+
+		expiresAt := in.ExpiresAt
+		if in.ExpiresInDays != nil {
+			if *in.ExpiresInDays <= 0 {
+				return nil, errors.New("expires_in_days must be positive")
+			}
+			t := time.Now().AddDate(0, 0, *in.ExpiresInDays)
+			expiresAt = &t
+		}
+		if expiresAt != nil && !expiresAt.After(time.Now()) {
+			return nil, errors.New("expiry must be in the future")
+		}
+
+		grants = append(grants, FileAccess{
+			UserID:      in.UserID,
+			GroupID:     in.GroupID,
+			FileID:      in.FileID,
+			AccessLevel: level,
+			Reason:      in.Reason,
+			GrantedBy:   &grantedBy,
+			ExpiresAt:   expiresAt,
+		})
+	}
+
+	if len(grants) == 0 {
+		return grants, nil
+	}
+
+	if err := fs.DB.Create(&grants).Error; err != nil {
+		return nil, err
+	}
+	return grants, nil
+}
+
+type grantRecipient struct {
+	Email     string
+	FirstName string `gorm:"column:firstname"`
+}
+
+// NotifyAccessGranted emails the users, or the members of the groups, that
+// received the grants, in the background. Delivery failures are only logged.
+func (fs *FileService) NotifyAccessGranted(grants []FileAccess) {
+	if fs.Mailer == nil {
+		return
+	}
+
+	// one mail per group member is too slow to send within the request
+	go fs.notifyAccessGranted(grants)
+}
+
+func (fs *FileService) notifyAccessGranted(grants []FileAccess) {
+	for _, g := range grants {
+		file, err := fs.GetFileByID(g.FileID)
+		if err != nil {
+			log.Printf("Failed to load file %d for access notification: %v", g.FileID, err)
+			continue
+		}
+
+		var granter grantRecipient
+		if g.GrantedBy != nil {
+			fs.DB.Table("users").Select("email, firstname").Where("id = ?", *g.GrantedBy).Scan(&granter)
+		}
+
+		var recipients []grantRecipient
+		q := fs.DB.Table("users").Select("users.email, users.firstname")
+		if g.UserID != nil {
+			q = q.Where("users.id = ?", *g.UserID)
+		} else {
+			q = q.Joins("JOIN user_group_members gm ON gm.user_id = users.id").Where("gm.group_id = ?", *g.GroupID)
+		}
+		if err := q.Scan(&recipients).Error; err != nil {
+			log.Printf("Failed to load recipients for access notification: %v", err)
+			continue
+		}
+
+		grantedBy := granter.FirstName
+		if grantedBy == "" {
+			grantedBy = "An administrator"
+		}
+
+		for _, r := range recipients {
+			data := map[string]any{
+				"FirstName":   r.FirstName,
+				"Filename":    file.Filename,
+				"AccessLevel": g.AccessLevel,
+				"Reason":      g.Reason,
+				"GrantedBy":   grantedBy,
+				"ExpiresAt":   g.ExpiresAt,
+			}
+			if err := mailer.SendTemplate(fs.Mailer, r.Email, "access_granted", data); err != nil {
+				log.Printf("Failed to send access notification to %s: %v", r.Email, err)
+			}
+		}
+	}
+}
+
+func (fs *FileService) DeleteAccess(accessId string, userID uint, role string) (*FileAccess, error) {
 	// Check if access record exists
 	var access FileAccess
 	if err := fs.DB.Where("id = ?", accessId).First(&access).Error; err != nil {
-		return err
+		return nil, err
+	}
+	if err := fs.canManageAccess(access.FileID, userID, role); err != nil {
+		return nil, err
 	}
 
 	// Delete access record
 	if err := fs.DB.Delete(&access).Error; err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	return &access, nil
 }
 
 func (fs *FileService) GetFileAccess(fileId string) ([]FileAccessWithUser, error) {
 	var results []FileAccessWithUser
 
 	err := fs.DB.Table("file_access").
-		Select("file_access.id, file_access.user_id, file_access.file_id, users.firstname, users.lastname").
-		Joins("JOIN users ON users.id = file_access.user_id").
+		Select(`file_access.id, file_access.user_id, file_access.group_id, file_access.file_id,
+		        COALESCE(users.firstname, '') AS firstname, COALESCE(users.lastname, '') AS lastname,
+		        COALESCE(user_groups.name, '') AS group_name, file_access.access_level, COALESCE(file_access.reason, '') AS reason,
+		        file_access.granted_by, COALESCE(g.firstname, '') AS granted_by_firstname, COALESCE(g.lastname, '') AS granted_by_lastname,
+		        file_access.expires_at, file_access.created_at`).
+		Joins("LEFT JOIN users ON users.id = file_access.user_id").
+		Joins("LEFT JOIN user_groups ON user_groups.id = file_access.group_id").
+		Joins("LEFT JOIN users g ON g.id = file_access.granted_by").
 		Where("file_access.file_id = ?", fileId).
+		Where("file_access.expires_at IS NULL OR file_access.expires_at > ?", time.Now()).
 		Scan(&results).Error
 
 	if err != nil {
@@ -395,6 +649,89 @@ func (fs *FileService) GetFileAccess(fileId string) ([]FileAccessWithUser, error
 	return results, nil
 }
 
+// CanAccessFile reports whether the user may use the file at the requested
+// access level. Public files stay open to everyone as before; private files
+// need an unexpired grant to the user or one of their groups.
+func (fs *FileService) CanAccessFile(userID uint, role string, file *File, level string) (bool, error) {
+	if role == "Admin" || file.InsertedBy == userID || !file.Private {
+		return true, nil
+	}
+
+	var grants []FileAccess
+	if err := fs.DB.
+		Where("file_id = ?", file.ID).
+		Where("user_id = ? OR group_id IN (SELECT group_id FROM user_group_members WHERE user_id = ?)", userID, userID).
+		Where("expires_at IS NULL OR expires_at > ?", time.Now()).
+		Find(&grants).Error; err != nil {
+		return false, err
+	}
+	for _, g := range grants {
+		if accessLevelRank[g.AccessLevel] >= accessLevelRank[level] {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// CanViewActivity reports whether the user may see who used the file: its
+// uploader, admins, users whose global role can approve and who can open the
+// file, and approvers in one of the file's communities
+func (fs *FileService) CanViewActivity(userID uint, role string, file *File) (bool, error) {
+	if role == "Admin" || file.InsertedBy == userID {
+		return true, nil
+	}
+
+	var count int64
+	if err := fs.DB.Model(&auth.Role{}).
+		Where("role = ? AND can_approve", role).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+	if count > 0 {
+		allowed, err := fs.CanAccessFile(userID, role, file, AccessLevelView)
+		if err != nil || allowed {
+			return allowed, err
+		}
+	}
+
+	if err := fs.DB.Table("file_community fc").
+		Joins("JOIN community c ON c.id = fc.community_id").
+		Joins("JOIN user_roles ur ON ur.community_name = c.community_name").
+		Joins("JOIN roles r ON r.role = ur.role").
+		Where("fc.file_id = ? AND ur.user_id = ? AND r.can_approve", file.ID, userID).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// DeleteExpiredAccess removes grants whose expiry has passed
+func (fs *FileService) DeleteExpiredAccess() (int64, error) {
+	result := fs.DB.Where("expires_at IS NOT NULL AND expires_at <= ?", time.Now()).Delete(&FileAccess{})
+	return result.RowsAffected, result.Error
+}
+
+// StartAccessSweeper periodically cleans up expired file access grants
+func (fs *FileService) StartAccessSweeper(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			removed, err := fs.DeleteExpiredAccess()
+			if err != nil {
+				log.Printf("Failed to remove expired file access: %v", err)
+				continue
+			}
+			if removed > 0 {
+				log.Printf("Removed %d expired file access grants", removed)
+			}
+		}
+	}()
+}
+
 func (fs *FileService) GetFileHistory(fileId string) ([]FileVersionWithUser, error) {
 	var results []FileVersionWithUser
 
@@ -477,3 +814,409 @@ func (fs *FileService) RevertFile(filename string, version int, userID uint) err
 
 	return nil
 }
+
+var (
+	ErrShareLinkInvalid  = errors.New("this link is invalid, expired or revoked")
+	ErrShareLinkPassword = errors.New("a valid password is required for this link")
+)
+
+func (fs *FileService) GetFileDataByID(fileID uint, version int) ([]FileData, error) {
+	var fileData []FileData
+	if err := fs.DB.Where("file_id = ? AND version = ?", fileID, version).Order("id ASC").Find(&fileData).Error; err != nil {
+		return nil, err
+	}
+	return fileData, nil
+}
+
+// WriteRowsCSV writes the JSON rows as CSV, using the column order of the
+// first row that introduces each column
+func WriteRowsCSV(w io.Writer, rows []FileData) error {
+	var headers []string
+	seen := map[string]bool{}
+	parsed := make([]*orderedmap.OrderedMap, 0, len(rows))
+
+	for _, row := range rows {
+		rowMap := orderedmap.New()
+		if err := json.Unmarshal(row.RowData, rowMap); err != nil {
+			return err
+		}
+		for _, key := range rowMap.Keys() {
+			if !seen[key] {
+				seen[key] = true
+				headers = append(headers, key)
+			}
+		}
+		parsed = append(parsed, rowMap)
+	}
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(headers); err != nil {
+		return err
+	}
+	for _, rowMap := range parsed {
+		record := make([]string, len(headers))
+		for i, header := range headers {
+			if val, ok := rowMap.Get(header); ok && val != nil {
+				record[i] = fmt.Sprint(val)
+			}
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func (fs *FileService) CreateShareLink(input ShareLinkInput, userID uint) (*FileShareLink, error) {
+	file, err := fs.GetFileByID(input.FileID)
+	if err != nil {
+		return nil, fmt.Errorf("file not found: %w", err)
+	}
+
+	version := input.Version
+	if version == 0 {
+		version = file.Version
+	}
+
+	var count int64
+	if err := fs.DB.Model(&FileVersion{}).Where("file_id = ? AND version = ?", file.ID, version).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return nil, fmt.Errorf("version %d not found", version)
+	}
+
+	if input.MaxUses != nil && *input.MaxUses <= 0 {
+		return nil, errors.New("max_uses must be positive")
+	}
+
+	link := FileShareLink{
+		FileID:    file.ID,
+		Version:   version,
+		ExpiresAt: time.Now().Add(time.Duration(input.ExpiresInHours) * time.Hour),
+		MaxUses:   input.MaxUses,
+		CreatedBy: userID,
+	}
+
+	if input.Password != "" {
+		hashed, err := util.HashPassword(input.Password)
+		if err != nil {
+			return nil, err
+		}
+		link.PasswordHash = &hashed
+	}
+
+	if err := fs.DB.Create(&link).Error; err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+func (fs *FileService) GetShareLinks(fileId string) ([]ShareLinkResponse, error) {
+	var links []FileShareLink
+	if err := fs.DB.Where("file_id = ?", fileId).Order("created_at DESC").Find(&links).Error; err != nil {
+		return nil, err
+	}
+
+	res := make([]ShareLinkResponse, 0, len(links))
+	for _, l := range links {
+		res = append(res, ShareLinkResponse{FileShareLink: l, HasPassword: l.PasswordHash != nil})
+	}
+	return res, nil
+}
+
+func (fs *FileService) GetShareLinkByID(linkId string) (*FileShareLink, error) {
+	var link FileShareLink
+	if err := fs.DB.Where("id = ?", linkId).First(&link).Error; err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+func (fs *FileService) RevokeShareLink(link *FileShareLink) error {
+	now := time.Now()
+	if err := fs.DB.Model(link).Update("revoked_at", now).Error; err != nil {
+		return err
+	}
+	link.RevokedAt = &now
+	return nil
+}
+
+// UseShareLink validates the link and password and counts the use. The
+// counter is only bumped while the link is still usable, so concurrent
+// requests cannot exceed max_uses.
+func (fs *FileService) UseShareLink(linkID uint, password string) (*FileShareLink, error) {
+	var link FileShareLink
+	if err := fs.DB.First(&link, linkID).Error; err != nil {
+		return nil, ErrShareLinkInvalid
+	}
+
+	if link.PasswordHash != nil {
+		if password == "" || util.VerifyPassword(password, *link.PasswordHash) != nil {
+			return nil, ErrShareLinkPassword
+		}
+	}
+
+	// a link to a deleted file must not use up its remaining uses
+	var file File
+	if err := fs.DB.Where("id = ? AND is_delete = ?", link.FileID, false).First(&file).Error; err != nil {
+		return nil, ErrShareLinkInvalid
+	}
+
+	now := time.Now()
+	result := fs.DB.Model(&FileShareLink{}).
+		Where("id = ? AND revoked_at IS NULL AND expires_at > ?", link.ID, now).
+		Where("max_uses IS NULL OR use_count < max_uses").
+		Updates(map[string]interface{}{
+			"use_count":    gorm.Expr("use_count + 1"),
+			"last_used_at": now,
+		})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrShareLinkInvalid
+	}
+
+	link.UseCount++
+	link.LastUsedAt = &now
+	return &link, nil
+}
+
+// SignShareToken produces the token embedded in a share URL
+func SignShareToken(link *FileShareLink, secret string) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"share_id": link.ID,
+		"file_id":  link.FileID,
+		"exp":      link.ExpiresAt.Unix(),
+	})
+	return token.SignedString([]byte(secret))
+}
+
+// ParseShareToken verifies the signature and expiry and returns the link ID
+func ParseShareToken(tokenString, secret string) (uint, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		return []byte(secret), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil || !token.Valid {
+		return 0, ErrShareLinkInvalid
+	}
+
+	claims := token.Claims.(jwt.MapClaims)
+	shareID, ok := claims["share_id"].(float64)
+	if !ok {
+		return 0, ErrShareLinkInvalid
+	}
+	return uint(shareID), nil
+}
+
+// Viewer describes who is reading file rows, for applying redaction policies
+type Viewer struct {
+	UserID      uint
+	IsAdmin     bool
+	Roles       []string
+	Communities []string
+}
+
+// GetViewer loads the user's global role plus their community roles. Only
+// the global role makes a viewer an admin; a community Admin row only counts
+// towards exempt roles and row filters.
+func (fs *FileService) GetViewer(userID uint) (Viewer, error) {
+	var user auth.Auth
+	if err := fs.DB.First(&user, userID).Error; err != nil {
+		return Viewer{}, err
+	}
+
+	viewer := Viewer{UserID: userID, IsAdmin: user.Role == "Admin", Roles: []string{user.Role}}
+
+	var userRoles []auth.UserRole
+	if err := fs.DB.Where("user_id = ?", userID).Find(&userRoles).Error; err != nil {
+		return Viewer{}, err
+	}
+	for _, ur := range userRoles {
+		viewer.Roles = append(viewer.Roles, ur.Role)
+		if ur.CommunityName != nil {
+			viewer.Communities = append(viewer.Communities, *ur.CommunityName)
+		}
+	}
+
+	return viewer, nil
+}
+
+func (fs *FileService) GetPolicies(fileId string) ([]FilePolicy, error) {
+	var policies []FilePolicy
+	if err := fs.DB.Where("file_id = ?", fileId).Order("id ASC").Find(&policies).Error; err != nil {
+		return nil, err
+	}
+	return policies, nil
+}
+
+func (fs *FileService) GetPolicyByID(policyId string) (*FilePolicy, error) {
+	var policy FilePolicy
+	if err := fs.DB.Where("id = ?", policyId).First(&policy).Error; err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+func (fs *FileService) CreatePolicy(input FilePolicyInput, userID uint) (*FilePolicy, error) {
+	switch input.PolicyType {
+	case PolicyTypeColumn:
+		if input.Action != PolicyActionHide && input.Action != PolicyActionMask {
+			return nil, errors.New("column policies must hide or mask")
+		}
+	case PolicyTypeRow:
+		if input.Action != PolicyActionEquals && input.Action != PolicyActionNotEquals {
+			return nil, errors.New("row policies must use equals or not_equals")
+		}
+	}
+
+	policy := FilePolicy{
+		FileID:      input.FileID,
+		PolicyType:  input.PolicyType,
+		ColumnName:  input.ColumnName,
+		Action:      input.Action,
+		Value:       input.Value,
+		ExemptRoles: input.ExemptRoles,
+		CreatedBy:   userID,
+	}
+	if policy.ExemptRoles == nil {
+		policy.ExemptRoles = []string{}
+	}
+
+	if err := fs.DB.Create(&policy).Error; err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+func (fs *FileService) DeletePolicy(policy *FilePolicy) error {
+	return fs.DB.Delete(policy).Error
+}
+
+// ApplyPolicies returns the rows the viewer may see, with hidden columns
+// removed and masked columns replaced. Admins see everything.
+func (fs *FileService) ApplyPolicies(fileID uint, viewer Viewer, rows []FileData) ([]FileData, error) {
+	if viewer.IsAdmin {
+		return rows, nil
+	}
+
+	var policies []FilePolicy
+	if err := fs.DB.Where("file_id = ?", fileID).Find(&policies).Error; err != nil {
+		return nil, err
+	}
+
+	var active []FilePolicy
+	for _, p := range policies {
+		if !policyExempt(p, viewer) {
+			active = append(active, p)
+		}
+	}
+	if len(active) == 0 {
+		return rows, nil
+	}
+
+	result := make([]FileData, 0, len(rows))
+	for _, row := range rows {
+		rowMap := orderedmap.New()
+		if err := json.Unmarshal(row.RowData, rowMap); err != nil {
+			return nil, err
+		}
+
+		if !rowAllowed(rowMap, active, viewer) {
+			continue
+		}
+
+		for _, p := range active {
+			if p.PolicyType != PolicyTypeColumn {
+				continue
+			}
+			if _, ok := rowMap.Get(p.ColumnName); !ok {
+				continue
+			}
+			if p.Action == PolicyActionHide {
+				rowMap.Delete(p.ColumnName)
+			} else {
+				rowMap.Set(p.ColumnName, "****")
+			}
+		}
+
+		jsonBytes, err := rowMap.MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+		row.RowData = jsonBytes
+		result = append(result, row)
+	}
+
+	return result, nil
+}
+
+func policyExempt(p FilePolicy, viewer Viewer) bool {
+	for _, exempt := range p.ExemptRoles {
+		for _, role := range viewer.Roles {
+			if strings.EqualFold(exempt, role) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func rowAllowed(rowMap *orderedmap.OrderedMap, policies []FilePolicy, viewer Viewer) bool {
+	for _, p := range policies {
+		if p.PolicyType != PolicyTypeRow {
+			continue
+		}
+
+		cell := ""
+		if val, ok := rowMap.Get(p.ColumnName); ok && val != nil {
+			cell = strings.TrimSpace(fmt.Sprint(val))
+		}
+
+		matched := false
+		if p.Value == PolicyValueUserCommunity {
+			for _, community := range viewer.Communities {
+				if strings.EqualFold(cell, strings.TrimSpace(community)) {
+					matched = true
+					break
+				}
+			}
+		} else {
+			matched = strings.EqualFold(cell, strings.TrimSpace(p.Value))
+		}
+
+		if p.Action == PolicyActionEquals && !matched {
+			return false
+		}
+		if p.Action == PolicyActionNotEquals && matched {
+			return false
+		}
+	}
+	return true
+}
+
+// SearchRows keeps the rows where any visible value contains the query
+func SearchRows(rows []FileData, query string) ([]FileData, error) {
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query == "" {
+		return rows, nil
+	}
+
+	var result []FileData
+	for _, row := range rows {
+		rowMap := orderedmap.New()
+		if err := json.Unmarshal(row.RowData, rowMap); err != nil {
+			return nil, err
+		}
+		for _, key := range rowMap.Keys() {
+			val, _ := rowMap.Get(key)
+			if val != nil && strings.Contains(strings.ToLower(fmt.Sprint(val)), query) {
+				result = append(result, row)
+				break
+			}
+		}
+	}
+	return result, nil
+}
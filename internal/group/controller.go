@@ -0,0 +1,285 @@
+package group
+
+import (
+	"fmt"
+	"net/http"
+	"nordik-drive-api/internal/logs"
+
+	"github.com/gin-gonic/gin"
+)
+
+type GroupController struct {
+	GroupService *GroupService
+	LogService   *logs.LogService
+}
+
+func (gc *GroupController) GetAllGroups(c *gin.Context) {
+	groups, err := gc.GroupService.GetAllGroups()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Groups fetched successfully",
+		"groups":  groups,
+	})
+}
+
+func (gc *GroupController) GetGroup(c *gin.Context) {
+	group, err := gc.GroupService.GetGroupByID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if group == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "group not found"})
+		return
+	}
+
+	members, err := gc.GroupService.GetMembers(group.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Group fetched successfully",
+		"group":   group,
+		"members": members,
+	})
+}
+
+func (gc *GroupController) CreateGroup(c *gin.Context) {
+	userIDVal, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user ID not found"})
+		return
+	}
+
+	userID, ok := userIDVal.(float64)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user ID"})
+		return
+	}
+
+	var input GroupInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	uid := uint(userID)
+
+	group, err := gc.GroupService.CreateGroup(input, uid)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	gc.LogService.Record(c, logs.Event{
+		Service:    "group",
+		Action:     logs.ActionCreateGroup,
+		Message:    fmt.Sprintf("Group created : %s", group.Name),
+		TargetType: logs.TargetGroup,
+		TargetID:   group.ID,
+		After:      group,
+	})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Group created successfully",
+		"group":   group,
+	})
+}
+
+func (gc *GroupController) UpdateGroup(c *gin.Context) {
+	_, group, ok := gc.loadManagedGroup(c)
+	if !ok {
+		return
+	}
+
+	var input GroupInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	before := gin.H{"name": group.Name, "description": group.Description}
+
+	group, err := gc.GroupService.UpdateGroup(group, input)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	gc.LogService.Record(c, logs.Event{
+		Service:    "group",
+		Action:     logs.ActionUpdateGroup,
+		Message:    fmt.Sprintf("Group updated : %s", group.Name),
+		TargetType: logs.TargetGroup,
+		TargetID:   group.ID,
+		Before:     before,
+		After:      gin.H{"name": group.Name, "description": group.Description},
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Group updated successfully",
+		"group":   group,
+	})
+}
+
+func (gc *GroupController) DeleteGroup(c *gin.Context) {
+	_, group, ok := gc.loadManagedGroup(c)
+	if !ok {
+		return
+	}
+
+	if err := gc.GroupService.DeleteGroup(group); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	gc.LogService.Record(c, logs.Event{
+		Level:      logs.LevelWarn,
+		Service:    "group",
+		Action:     logs.ActionDeleteGroup,
+		Message:    fmt.Sprintf("Group deleted : %s", group.Name),
+		TargetType: logs.TargetGroup,
+		TargetID:   group.ID,
+		Before:     group,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Group deleted successfully",
+	})
+}
+
+func (gc *GroupController) AddMembers(c *gin.Context) {
+	_, group, ok := gc.loadMemberGroup(c)
+	if !ok {
+		return
+	}
+
+	var input GroupMembersInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := gc.GroupService.AddMembers(group.ID, input.UserIDs); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	gc.LogService.Record(c, logs.Event{
+		Service:    "group",
+		Action:     logs.ActionAddGroupMembers,
+		Message:    fmt.Sprintf("Members added to group : %s", group.Name),
+		TargetType: logs.TargetGroup,
+		TargetID:   group.ID,
+		Metadata:   input,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Group members added successfully",
+	})
+}
+
+func (gc *GroupController) RemoveMember(c *gin.Context) {
+	_, group, ok := gc.loadMemberGroup(c)
+	if !ok {
+		return
+	}
+
+	memberID := c.Param("userId")
+	if err := gc.GroupService.RemoveMember(group.ID, memberID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	gc.LogService.Record(c, logs.Event{
+		Level:      logs.LevelWarn,
+		Service:    "group",
+		Action:     logs.ActionRemoveGroupMember,
+		Message:    fmt.Sprintf("Member %s removed from group : %s", memberID, group.Name),
+		TargetType: logs.TargetGroup,
+		TargetID:   group.ID,
+		Metadata:   gin.H{"user_id": memberID},
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Group member removed successfully",
+	})
+}
+
+// loadManagedGroup resolves the group from the path and checks that the caller
+// created it or is an admin. It writes the error response itself on failure.
+func (gc *GroupController) loadManagedGroup(c *gin.Context) (uint, *Group, bool) {
+	userIDVal, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user ID not found"})
+		return 0, nil, false
+	}
+
+	userID, ok := userIDVal.(float64)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user ID"})
+		return 0, nil, false
+	}
+	uid := uint(userID)
+
+	group, err := gc.GroupService.GetGroupByID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return 0, nil, false
+	}
+	if group == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "group not found"})
+		return 0, nil, false
+	}
+
+	if group.CreatedBy != uid {
+		role, err := gc.GroupService.GetUserRole(uid)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return 0, nil, false
+		}
+		if role != "Admin" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "only the group creator or an admin can manage this group"})
+			return 0, nil, false
+		}
+	}
+
+	return uid, group, true
+}
+
+// loadMemberGroup is loadManagedGroup for membership changes. Once a group
+// holds file access its members decide who can open those files, so only
+// admins may change them.
+func (gc *GroupController) loadMemberGroup(c *gin.Context) (uint, *Group, bool) {
+	uid, group, ok := gc.loadManagedGroup(c)
+	if !ok {
+		return 0, nil, false
+	}
+
+	hasAccess, err := gc.GroupService.HasFileAccess(group.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return 0, nil, false
+	}
+	if !hasAccess {
+		return uid, group, true
+	}
+
+	role, err := gc.GroupService.GetUserRole(uid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return 0, nil, false
+	}
+	if role != "Admin" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only an admin can change the members of a group with file access"})
+		return 0, nil, false
+	}
+
+	return uid, group, true
+}
@@ -0,0 +1,53 @@
+package group
+
+import (
+	"time"
+)
+
+type Group struct {
+	ID          uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	Name        string    `gorm:"size:255;not null;unique" json:"name"`
+	Description string    `gorm:"type:text" json:"description"`
+	CreatedBy   uint      `gorm:"not null" json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type GroupMember struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	GroupID   uint      `gorm:"not null;index" json:"group_id"`
+	UserID    uint      `gorm:"not null;index" json:"user_id"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+type GroupMemberWithUser struct {
+	ID        uint      `json:"id"`
+	GroupID   uint      `json:"group_id"`
+	UserID    uint      `json:"user_id"`
+	FirstName string    `json:"firstname" gorm:"column:firstname"`
+	LastName  string    `json:"lastname" gorm:"column:lastname"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type GroupWithCount struct {
+	Group
+	MemberCount int `json:"member_count"`
+}
+
+type GroupInput struct {
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"description"`
+}
+
+type GroupMembersInput struct {
+	UserIDs []uint `json:"user_ids" binding:"required"`
+}
+
+func (Group) TableName() string {
+	return "user_groups"
+}
+
+func (GroupMember) TableName() string {
+	return "user_group_members"
+}
@@ -0,0 +1,25 @@
+package group
+
+import (
+	"nordik-drive-api/internal/logs"
+	"nordik-drive-api/internal/middlewares"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterRoutes(r *gin.Engine, groupService *GroupService, logService *logs.LogService) {
+	groupController := &GroupController{GroupService: groupService, LogService: logService}
+
+	userGroup := r.Group("/api/group")
+	userGroup.Use(middlewares.AuthMiddleware())
+	{
+		userGroup.GET("", groupController.GetAllGroups)
+		userGroup.GET("/:id", groupController.GetGroup)
+		userGroup.POST("", groupController.CreateGroup)
+		userGroup.PUT("/:id", groupController.UpdateGroup)
+		userGroup.DELETE("/:id", groupController.DeleteGroup)
+		userGroup.POST("/:id/members", groupController.AddMembers)
+		userGroup.DELETE("/:id/members/:userId", groupController.RemoveMember)
+	}
+
+}
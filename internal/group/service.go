@@ -0,0 +1,153 @@
+package group
+
+import (
+	"errors"
+	"nordik-drive-api/internal/auth"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type GroupService struct {
+	DB *gorm.DB
+}
+
+func (gs *GroupService) GetAllGroups() ([]GroupWithCount, error) {
+	var groups []GroupWithCount
+	err := gs.DB.Table("user_groups g").
+		Select("g.*, COUNT(m.id) AS member_count").
+		Joins("LEFT JOIN user_group_members m ON m.group_id = g.id").
+		Group("g.id").
+		Order("g.name ASC").
+		Scan(&groups).Error
+	if err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+func (gs *GroupService) GetGroupByID(id string) (*Group, error) {
+	var group Group
+	if err := gs.DB.Where("id = ?", id).First(&group).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &group, nil
+}
+
+func (gs *GroupService) CreateGroup(input GroupInput, createdBy uint) (*Group, error) {
+	group := Group{
+		Name:        strings.TrimSpace(input.Name),
+		Description: input.Description,
+		CreatedBy:   createdBy,
+	}
+	if group.Name == "" {
+		return nil, errors.New("group name is required")
+	}
+
+	if err := gs.DB.Create(&group).Error; err != nil {
+		if strings.Contains(err.Error(), "duplicate key") || strings.Contains(err.Error(), "unique constraint") {
+			return nil, errors.New("a group with this name already exists")
+		}
+		return nil, err
+	}
+	return &group, nil
+}
+
+func (gs *GroupService) UpdateGroup(group *Group, input GroupInput) (*Group, error) {
+	name := strings.TrimSpace(input.Name)
+	if name == "" {
+		return nil, errors.New("group name is required")
+	}
+
+	if err := gs.DB.Model(group).Updates(map[string]interface{}{
+		"name":        name,
+		"description": input.Description,
+	}).Error; err != nil {
+		if strings.Contains(err.Error(), "duplicate key") || strings.Contains(err.Error(), "unique constraint") {
+			return nil, errors.New("a group with this name already exists")
+		}
+		return nil, err
+	}
+	return group, nil
+}
+
+func (gs *GroupService) DeleteGroup(group *Group) error {
+	// members and group file_access rows are removed by ON DELETE CASCADE
+	return gs.DB.Delete(group).Error
+}
+
+func (gs *GroupService) GetMembers(groupID uint) ([]GroupMemberWithUser, error) {
+	var members []GroupMemberWithUser
+	err := gs.DB.Table("user_group_members m").
+		Select("m.id, m.group_id, m.user_id, u.firstname, u.lastname, u.email, m.created_at").
+		Joins("JOIN users u ON u.id = m.user_id").
+		Where("m.group_id = ?", groupID).
+		Order("u.firstname ASC, u.lastname ASC").
+		Scan(&members).Error
+	if err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+// AddMembers adds the users to the group, skipping existing members
+func (gs *GroupService) AddMembers(groupID uint, userIDs []uint) error {
+	return gs.DB.Transaction(func(tx *gorm.DB) error {
+		for _, userID := range userIDs {
+			var count int64
+			if err := tx.Model(&auth.Auth{}).Where("id = ?", userID).Count(&count).Error; err != nil {
+				return err
+			}
+			if count == 0 {
+				return errors.New("user not found")
+			}
+
+			if err := tx.Model(&GroupMember{}).Where("group_id = ? AND user_id = ?", groupID, userID).Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				continue
+			}
+
+			member := GroupMember{GroupID: groupID, UserID: userID}
+			if err := tx.Create(&member).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (gs *GroupService) RemoveMember(groupID uint, userID string) error {
+	result := gs.DB.Where("group_id = ? AND user_id = ?", groupID, userID).Delete(&GroupMember{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("member not found")
+	}
+	return nil
+}
+
+// HasFileAccess reports whether the group holds an unexpired file grant
+func (gs *GroupService) HasFileAccess(groupID uint) (bool, error) {
+	var count int64
+	if err := gs.DB.Table("file_access").
+		Where("group_id = ? AND (expires_at IS NULL OR expires_at > ?)", groupID, time.Now()).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (gs *GroupService) GetUserRole(userID uint) (string, error) {
+	var user auth.Auth
+	if err := gs.DB.First(&user, userID).Error; err != nil {
+		return "", err
+	}
+	return user.Role, nil
+}
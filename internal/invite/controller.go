@@ -0,0 +1,190 @@
+package invite
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"nordik-drive-api/internal/logs"
+	"nordik-drive-api/internal/password"
+
+	"github.com/gin-gonic/gin"
+)
+
+type InviteController struct {
+	InviteService *InviteService
+	LogService    *logs.LogService
+}
+
+func (ic *InviteController) CreateInvitation(c *gin.Context) {
+	userIDVal, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user ID not found"})
+		return
+	}
+
+	userID, ok := userIDVal.(float64)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user ID"})
+		return
+	}
+
+	var input InvitationInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	uid := uint(userID)
+
+	invitation, err := ic.InviteService.CreateInvitation(input, uid)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrNotAllowed):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case errors.Is(err, ErrAlreadyRegistered):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	ic.LogService.Record(c, logs.Event{
+		Service:    "invite",
+		Action:     logs.ActionInviteUser,
+		Message:    fmt.Sprintf("Invitation sent to %s as %s", invitation.Email, invitation.Role),
+		TargetType: logs.TargetInvitation,
+		TargetID:   invitation.ID,
+		Metadata:   invitation,
+	})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":    "Invitation sent successfully",
+		"invitation": invitation,
+	})
+}
+
+func (ic *InviteController) GetInvitations(c *gin.Context) {
+	userIDVal, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user ID not found"})
+		return
+	}
+
+	userID, ok := userIDVal.(float64)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user ID"})
+		return
+	}
+
+	invitations, err := ic.InviteService.GetInvitations(uint(userID))
+	if err != nil {
+		if errors.Is(err, ErrNotAllowed) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "Invitations fetched successfully",
+		"invitations": invitations,
+	})
+}
+
+func (ic *InviteController) RevokeInvitation(c *gin.Context) {
+	userIDVal, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user ID not found"})
+		return
+	}
+
+	userID, ok := userIDVal.(float64)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user ID"})
+		return
+	}
+
+	uid := uint(userID)
+
+	invitation, err := ic.InviteService.RevokeInvitation(c.Param("id"), uid)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrNotAllowed):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case errors.Is(err, ErrInvitationNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	ic.LogService.Record(c, logs.Event{
+		Level:      logs.LevelWarn,
+		Service:    "invite",
+		Action:     logs.ActionRevokeInvite,
+		Message:    fmt.Sprintf("Invitation for %s revoked", invitation.Email),
+		TargetType: logs.TargetInvitation,
+		TargetID:   invitation.ID,
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Invitation revoked"})
+}
+
+// GET /api/invite/accept?token=
+func (ic *InviteController) PreviewInvitation(c *gin.Context) {
+	preview, err := ic.InviteService.PreviewInvitation(c.Query("token"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"invitation": preview})
+}
+
+// POST /api/invite/accept
+func (ic *InviteController) AcceptInvitation(c *gin.Context) {
+	var input AcceptInvitationInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, invitation, err := ic.InviteService.AcceptInvitation(input)
+	if err != nil {
+		var policyErr *password.PolicyError
+		switch {
+		case errors.Is(err, ErrInvalidInvitation), errors.As(err, &policyErr):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, ErrAlreadyRegistered):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	uid := uint(user.ID)
+
+	ic.LogService.Record(c, logs.Event{
+		Service:    "invite",
+		Action:     logs.ActionAcceptInvite,
+		Message:    fmt.Sprintf("Account created from invitation for %s", user.Email),
+		UserID:     &uid,
+		TargetType: logs.TargetUser,
+		TargetID:   uid,
+		Metadata:   gin.H{"invitation_id": invitation.ID, "invited_by": invitation.InvitedBy, "role": invitation.Role, "community_name": invitation.CommunityName},
+	})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Account created, you can now log in",
+		"user": map[string]interface{}{
+			"id":        user.ID,
+			"firstname": user.FirstName,
+			"lastname":  user.LastName,
+			"email":     user.Email,
+		},
+	})
+}
@@ -0,0 +1,54 @@
+package invite
+
+import (
+	"time"
+)
+
+// Invitation lets someone create an account with a role, and optionally a
+// community, chosen by the inviter. Only the hash of the link token is stored.
+type Invitation struct {
+	ID             uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	Email          string     `gorm:"size:100;not null;index" json:"email"`
+	Role           string     `gorm:"size:100;not null" json:"role"`
+	CommunityName  *string    `gorm:"size:255" json:"community_name,omitempty"`
+	TokenHash      string     `gorm:"size:64;not null;uniqueIndex" json:"-"`
+	InvitedBy      uint       `gorm:"not null" json:"invited_by"`
+	ExpiresAt      time.Time  `gorm:"not null" json:"expires_at"`
+	AcceptedAt     *time.Time `json:"accepted_at,omitempty"`
+	AcceptedUserID *int       `json:"accepted_user_id,omitempty"`
+	RevokedAt      *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt      time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+type InvitationWithInviter struct {
+	Invitation
+	InviterFirstName string `json:"inviter_firstname" gorm:"column:inviter_firstname"`
+	InviterLastName  string `json:"inviter_lastname" gorm:"column:inviter_lastname"`
+	Status           string `json:"status" gorm:"-"`
+}
+
+type InvitationInput struct {
+	Email         string  `json:"email" binding:"required,email"`
+	Role          string  `json:"role" binding:"required"`
+	CommunityName *string `json:"community_name"`
+	ExpiresInDays int     `json:"expires_in_days" binding:"omitempty,min=1,max=30"`
+}
+
+type AcceptInvitationInput struct {
+	Token     string `json:"token" binding:"required"`
+	FirstName string `json:"firstname" binding:"required"`
+	LastName  string `json:"lastname" binding:"required"`
+	Password  string `json:"password" binding:"required"`
+}
+
+// InvitationPreview is what the accept page shows before the account exists
+type InvitationPreview struct {
+	Email         string    `json:"email"`
+	Role          string    `json:"role"`
+	CommunityName *string   `json:"community_name,omitempty"`
+	ExpiresAt     time.Time `json:"expires_at"`
+}
+
+func (Invitation) TableName() string {
+	return "user_invitations"
+}
@@ -0,0 +1,21 @@
+package invite
+
+import (
+	"nordik-drive-api/internal/logs"
+	"nordik-drive-api/internal/middlewares"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterRoutes(r *gin.Engine, inviteService *InviteService, logService *logs.LogService) {
+	inviteController := &InviteController{InviteService: inviteService, LogService: logService}
+
+	inviteGroup := r.Group("/api/invite")
+	{
+		inviteGroup.GET("/accept", inviteController.PreviewInvitation)
+		inviteGroup.POST("/accept", inviteController.AcceptInvitation)
+		inviteGroup.GET("", middlewares.AuthMiddleware(), inviteController.GetInvitations)
+		inviteGroup.POST("", middlewares.AuthMiddleware(), inviteController.CreateInvitation)
+		inviteGroup.DELETE("/:id", middlewares.AuthMiddleware(), inviteController.RevokeInvitation)
+	}
+}
@@ -0,0 +1,343 @@
+package invite
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"nordik-drive-api/config"
+	"nordik-drive-api/internal/auth"
+	"nordik-drive-api/internal/mailer"
+	"nordik-drive-api/internal/password"
+	"nordik-drive-api/internal/util"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type InviteService struct {
+	DB        *gorm.DB
+	CFG       *config.Config
+	Mailer    mailer.Mailer
+	Passwords *password.Policy
+}
+
+const defaultInviteDays = 7
+
+var (
+	ErrNotAllowed         = errors.New("only admins and community managers can invite users")
+	ErrInvalidInvitation  = errors.New("invalid or expired invitation")
+	ErrAlreadyRegistered  = errors.New("an account with this email already exists")
+	ErrInvitationNotFound = errors.New("invitation not found")
+)
+
+// inviter describes what the caller may hand out: admins anything, managers
+// only lower-priority roles in the communities they manage
+type inviter struct {
+	UserID      uint
+	Name        string
+	IsAdmin     bool
+	Priority    int
+	Communities []string
+}
+
+func (is *InviteService) getInviter(userID uint) (*inviter, error) {
+	var user auth.Auth
+	if err := is.DB.First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+
+	inv := &inviter{UserID: userID, Name: strings.TrimSpace(user.FirstName + " " + user.LastName)}
+	if user.Role == "Admin" {
+		inv.IsAdmin = true
+		return inv, nil
+	}
+
+	if err := is.DB.Model(&auth.UserRole{}).
+		Where("user_id = ? AND role = ? AND community_name IS NOT NULL", userID, "Manager").
+		Pluck("community_name", &inv.Communities).Error; err != nil {
+		return nil, err
+	}
+	if len(inv.Communities) == 0 {
+		return nil, ErrNotAllowed
+	}
+
+	var manager auth.Role
+	if err := is.DB.Where("role = ?", "Manager").First(&manager).Error; err != nil {
+		return nil, err
+	}
+	inv.Priority = manager.Priority
+	return inv, nil
+}
+
+func (inv *inviter) manages(community string) bool {
+	for _, c := range inv.Communities {
+		if c == community {
+			return true
+		}
+	}
+	return false
+}
+
+func (inv *inviter) canSee(i *Invitation) bool {
+	if inv.IsAdmin || i.InvitedBy == inv.UserID {
+		return true
+	}
+	return i.CommunityName != nil && inv.manages(*i.CommunityName)
+}
+
+// CreateInvitation stores a new invitation, replacing any pending one for the
+// same email, and mails the link
+func (is *InviteService) CreateInvitation(input InvitationInput, inviterID uint) (*Invitation, error) {
+	inv, err := is.getInviter(inviterID)
+	if err != nil {
+		return nil, err
+	}
+
+	email := strings.ToLower(strings.TrimSpace(input.Email))
+
+	var role auth.Role
+	if err := is.DB.Where("role = ?", input.Role).First(&role).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("unknown role: %s", input.Role)
+		}
+		return nil, err
+	}
+
+	var community *string
+	if input.CommunityName != nil && strings.TrimSpace(*input.CommunityName) != "" {
+		name := strings.TrimSpace(*input.CommunityName)
+		var count int64
+		if err := is.DB.Table("community").Where("community_name = ?", name).Count(&count).Error; err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			return nil, fmt.Errorf("unknown community: %s", name)
+		}
+		community = &name
+	}
+
+	if !inv.IsAdmin {
+		if community == nil || !inv.manages(*community) {
+			return nil, errors.New("managers can only invite into communities they manage")
+		}
+		if role.Priority <= inv.Priority {
+			return nil, errors.New("managers can only assign roles below their own")
+		}
+	}
+
+	var existing int64
+	if err := is.DB.Model(&auth.Auth{}).Where("LOWER(email) = ?", email).Count(&existing).Error; err != nil {
+		return nil, err
+	}
+	if existing > 0 {
+		return nil, ErrAlreadyRegistered
+	}
+
+	token, err := util.GenerateToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	days := input.ExpiresInDays
+	if days == 0 {
+		days = defaultInviteDays
+	}
+
+	invitation := Invitation{
+		Email:         email,
+		Role:          role.Role,
+		CommunityName: community,
+		TokenHash:     util.HashToken(token),
+		InvitedBy:     inviterID,
+		ExpiresAt:     time.Now().AddDate(0, 0, days),
+	}
+
+	err = is.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&Invitation{}).
+			Where("email = ? AND accepted_at IS NULL AND revoked_at IS NULL", email).
+			Update("revoked_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return tx.Create(&invitation).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	data := map[string]any{
+		"Inviter":   inv.Name,
+		"Role":      invitation.Role,
+		"Community": invitation.CommunityName,
+		"Link":      strings.TrimRight(is.CFG.AppURL, "/") + "/accept-invite?token=" + url.QueryEscape(token),
+		"ExpiresAt": invitation.ExpiresAt,
+	}
+	if err := mailer.SendTemplate(is.Mailer, email, "invitation", data); err != nil {
+		log.Printf("Failed to send invitation to %s: %v", email, err)
+	}
+
+	return &invitation, nil
+}
+
+// GetInvitations lists the invitations the caller may manage, newest first
+func (is *InviteService) GetInvitations(userID uint) ([]InvitationWithInviter, error) {
+	inv, err := is.getInviter(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	db := is.DB.Table("user_invitations").
+		Select("user_invitations.*, u.firstname AS inviter_firstname, u.lastname AS inviter_lastname").
+		Joins("LEFT JOIN users u ON u.id = user_invitations.invited_by")
+	if !inv.IsAdmin {
+		db = db.Where("user_invitations.invited_by = ? OR user_invitations.community_name IN ?", userID, inv.Communities)
+	}
+
+	var invitations []InvitationWithInviter
+	if err := db.Order("user_invitations.created_at DESC").Scan(&invitations).Error; err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	for i := range invitations {
+		invitations[i].Status = invitations[i].status(now)
+	}
+	return invitations, nil
+}
+
+func (i *Invitation) status(now time.Time) string {
+	switch {
+	case i.AcceptedAt != nil:
+		return "accepted"
+	case i.RevokedAt != nil:
+		return "revoked"
+	case now.After(i.ExpiresAt):
+		return "expired"
+	default:
+		return "pending"
+	}
+}
+
+// RevokeInvitation stops a pending invitation from being accepted
+func (is *InviteService) RevokeInvitation(id string, userID uint) (*Invitation, error) {
+	inv, err := is.getInviter(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var invitation Invitation
+	if err := is.DB.Where("id = ?", id).First(&invitation).Error; err != nil {
+		return nil, ErrInvitationNotFound
+	}
+	if !inv.canSee(&invitation) {
+		return nil, ErrInvitationNotFound
+	}
+	if invitation.status(time.Now()) != "pending" {
+		return nil, errors.New("only pending invitations can be revoked")
+	}
+
+	now := time.Now()
+	if err := is.DB.Model(&invitation).Update("revoked_at", now).Error; err != nil {
+		return nil, err
+	}
+	invitation.RevokedAt = &now
+	return &invitation, nil
+}
+
+func pendingByToken(db *gorm.DB, token string) (*Invitation, error) {
+	var invitation Invitation
+	if err := db.Where("token_hash = ?", util.HashToken(token)).First(&invitation).Error; err != nil {
+		return nil, ErrInvalidInvitation
+	}
+	if invitation.status(time.Now()) != "pending" {
+		return nil, ErrInvalidInvitation
+	}
+	return &invitation, nil
+}
+
+// PreviewInvitation returns the details shown on the accept page
+func (is *InviteService) PreviewInvitation(token string) (*InvitationPreview, error) {
+	invitation, err := pendingByToken(is.DB, token)
+	if err != nil {
+		return nil, err
+	}
+	return &InvitationPreview{
+		Email:         invitation.Email,
+		Role:          invitation.Role,
+		CommunityName: invitation.CommunityName,
+		ExpiresAt:     invitation.ExpiresAt,
+	}, nil
+}
+
+// AcceptInvitation creates the account with its UserRole row. The email is
+// treated as verified since the link was delivered to it.
+func (is *InviteService) AcceptInvitation(input AcceptInvitationInput) (*auth.Auth, *Invitation, error) {
+	if err := is.Passwords.Validate(input.Password); err != nil {
+		return nil, nil, err
+	}
+
+	hashed, err := util.HashPassword(input.Password)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var user auth.Auth
+	var invitation *Invitation
+
+	err = is.DB.Transaction(func(tx *gorm.DB) error {
+		invitation, err = pendingByToken(tx.Clauses(clause.Locking{Strength: "UPDATE"}), input.Token)
+		if err != nil {
+			return err
+		}
+
+		var existing int64
+		if err := tx.Model(&auth.Auth{}).Where("LOWER(email) = ?", invitation.Email).Count(&existing).Error; err != nil {
+			return err
+		}
+		if existing > 0 {
+			return ErrAlreadyRegistered
+		}
+
+		// A community role is held through user_roles; the global role
+		// stays at User unless the invitation is not tied to a community
+		globalRole := invitation.Role
+		if invitation.CommunityName != nil {
+			globalRole = "User"
+		}
+
+		now := time.Now()
+		user = auth.Auth{
+			FirstName:       strings.TrimSpace(input.FirstName),
+			LastName:        strings.TrimSpace(input.LastName),
+			Email:           invitation.Email,
+			Password:        hashed,
+			Role:            globalRole,
+			EmailVerifiedAt: &now,
+		}
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Create(&auth.UserRole{
+			Role:          invitation.Role,
+			UserID:        user.ID,
+			CommunityName: invitation.CommunityName,
+		}).Error; err != nil {
+			return err
+		}
+
+		invitation.AcceptedAt = &now
+		invitation.AcceptedUserID = &user.ID
+		return tx.Model(invitation).Updates(map[string]interface{}{
+			"accepted_at":      now,
+			"accepted_user_id": user.ID,
+		}).Error
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &user, invitation, nil
+}
@@ -0,0 +1,72 @@
+package logs
+
+import (
+	"math"
+	"time"
+)
+
+// FileActivityActions are the events shown to a file's owner
+var FileActivityActions = []Action{
+	ActionAccessFile,
+	ActionExportFile,
+	ActionChatFile,
+	ActionCreateShareLink,
+	ActionRevokeShareLink,
+	ActionShareLinkView,
+	ActionShareLinkDownload,
+	ActionShareLinkDenied,
+}
+
+type ActivityInput struct {
+	Action   *string `form:"action"`
+	Page     int     `form:"page"`
+	PageSize int     `form:"page_size"`
+}
+
+// ActivityEntry leaves out the IP, user agent and metadata, which are only
+// for admins
+type ActivityEntry struct {
+	ID        uint      `json:"id"`
+	Action    string    `json:"action"`
+	Message   string    `json:"message"`
+	UserID    *uint     `json:"user_id,omitempty"`
+	FirstName *string   `gorm:"column:firstname" json:"firstname,omitempty"`
+	LastName  *string   `gorm:"column:lastname" json:"lastname,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// FileActivity pages through a file's activity, newest first. Share link
+// visits have no user.
+func (ls *LogService) FileActivity(fileID uint, input ActivityInput) ([]ActivityEntry, int64, int, error) {
+	if input.Page <= 0 {
+		input.Page = 1
+	}
+	if input.PageSize <= 0 || input.PageSize > 100 {
+		input.PageSize = 20
+	}
+
+	db := ls.DB.Table("logs").
+		Joins("LEFT JOIN users a ON logs.user_id = a.id").
+		Where("logs.target_type = ? AND logs.target_id = ? AND logs.action IN ?", TargetFile, fileID, FileActivityActions)
+	if input.Action != nil {
+		db = db.Where("logs.action = ?", *input.Action)
+	}
+
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, 0, err
+	}
+
+	entries := []ActivityEntry{}
+	if err := db.
+		Select("logs.id, logs.action, logs.message, logs.user_id, a.firstname, a.lastname, logs.created_at").
+		Order("logs.created_at DESC, logs.id DESC").
+		Limit(input.PageSize).
+		Offset((input.Page - 1) * input.PageSize).
+		Scan(&entries).Error; err != nil {
+		return nil, 0, 0, err
+	}
+
+	totalPages := int(math.Ceil(float64(total) / float64(input.PageSize)))
+	return entries, total, totalPages, nil
+}
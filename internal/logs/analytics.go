@@ -0,0 +1,213 @@
+package logs
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AnalyticsInput bounds an aggregate query. Dates are "YYYY-MM-DD" and both
+// ends are inclusive; without them the last 30 days are used.
+type AnalyticsInput struct {
+	StartDate *string `form:"start_date"`
+	EndDate   *string `form:"end_date"`
+	Action    *string `form:"action"`
+	Limit     int     `form:"limit"`
+}
+
+type ActionCount struct {
+	Day    string `json:"day"`
+	Action string `json:"action"`
+	Count  int64  `json:"count"`
+}
+
+type FileCount struct {
+	FileID   uint    `json:"file_id"`
+	Filename *string `json:"filename"`
+	Count    int64   `json:"count"`
+	Users    int64   `json:"users"`
+}
+
+type UserActivity struct {
+	UserID    uint      `json:"user_id"`
+	FirstName *string   `gorm:"column:firstname" json:"firstname"`
+	LastName  *string   `gorm:"column:lastname" json:"lastname"`
+	Count     int64     `json:"count"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+type KeyCount struct {
+	Key   string `json:"key"`
+	Count int64  `json:"count"`
+}
+
+type FailedLoginStats struct {
+	PerDay  []ActionCount `json:"per_day"`
+	ByIP    []KeyCount    `json:"by_ip"`
+	ByEmail []KeyCount    `json:"by_email"`
+}
+
+var ErrInvalidRange = errors.New("dates must be YYYY-MM-DD with start_date before end_date")
+
+// accessActions count as someone opening a file
+var accessActions = []Action{ActionAccessFile, ActionShareLinkView, ActionShareLinkDownload}
+
+// failedLoginActions are the ways a sign in attempt can be rejected
+var failedLoginActions = []Action{ActionLoginFailed, ActionTwoFactorFailed, ActionSSOLoginFailed}
+
+const dayColumn = "TO_CHAR(DATE_TRUNC('day', logs.created_at), 'YYYY-MM-DD')"
+
+// inRange starts a query over logs limited to the input's dates
+func (ls *LogService) inRange(input AnalyticsInput) (*gorm.DB, error) {
+	end := time.Now()
+	start := end.AddDate(0, 0, -30)
+
+	if input.StartDate != nil {
+		t, err := time.ParseInLocation("2006-01-02", *input.StartDate, time.Local)
+		if err != nil {
+			return nil, ErrInvalidRange
+		}
+		start = t
+	}
+	if input.EndDate != nil {
+		t, err := time.ParseInLocation("2006-01-02", *input.EndDate, time.Local)
+		if err != nil {
+			return nil, ErrInvalidRange
+		}
+		end = t.AddDate(0, 0, 1)
+	}
+	if !start.Before(end) {
+		return nil, ErrInvalidRange
+	}
+
+	return ls.DB.Table("logs").Where("logs.created_at >= ? AND logs.created_at < ?", start, end), nil
+}
+
+func limitOf(input AnalyticsInput) int {
+	if input.Limit <= 0 || input.Limit > 100 {
+		return 10
+	}
+	return input.Limit
+}
+
+// ActionsPerDay counts entries per day and action, optionally for one action
+func (ls *LogService) ActionsPerDay(input AnalyticsInput) ([]ActionCount, error) {
+	db, err := ls.inRange(input)
+	if err != nil {
+		return nil, err
+	}
+	if input.Action != nil {
+		db = db.Where("logs.action = ?", *input.Action)
+	}
+
+	counts := []ActionCount{}
+	err = db.Select(dayColumn + " AS day, logs.action, COUNT(*) AS count").
+		Group("day, logs.action").
+		Order("day, logs.action").
+		Scan(&counts).Error
+	return counts, err
+}
+
+// TopFiles returns the files opened most often, with how many distinct
+// users opened each
+func (ls *LogService) TopFiles(input AnalyticsInput) ([]FileCount, error) {
+	db, err := ls.inRange(input)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []FileCount{}
+	err = db.Select("logs.target_id AS file_id, f.filename, COUNT(*) AS count, COUNT(DISTINCT logs.user_id) AS users").
+		Joins("LEFT JOIN file f ON f.id = logs.target_id").
+		Where("logs.target_type = ? AND logs.action IN ?", TargetFile, accessActions).
+		Group("logs.target_id, f.filename").
+		Order("count DESC, file_id").
+		Limit(limitOf(input)).
+		Scan(&files).Error
+	return files, err
+}
+
+// TopUsers returns the users with the most logged actions
+func (ls *LogService) TopUsers(input AnalyticsInput) ([]UserActivity, error) {
+	db, err := ls.inRange(input)
+	if err != nil {
+		return nil, err
+	}
+	if input.Action != nil {
+		db = db.Where("logs.action = ?", *input.Action)
+	}
+
+	users := []UserActivity{}
+	err = db.Select("logs.user_id, a.firstname, a.lastname, COUNT(*) AS count, MAX(logs.created_at) AS last_seen").
+		Joins("JOIN users a ON a.id = logs.user_id").
+		Group("logs.user_id, a.firstname, a.lastname").
+		Order("count DESC, logs.user_id").
+		Limit(limitOf(input)).
+		Scan(&users).Error
+	return users, err
+}
+
+// FailedLogins counts rejected sign in attempts per day and action, and the
+// IPs and emails that failed most
+func (ls *LogService) FailedLogins(input AnalyticsInput) (*FailedLoginStats, error) {
+	db, err := ls.inRange(input)
+	if err != nil {
+		return nil, err
+	}
+	db = db.Where("logs.action IN ?", failedLoginActions)
+
+	stats := &FailedLoginStats{PerDay: []ActionCount{}, ByIP: []KeyCount{}, ByEmail: []KeyCount{}}
+
+	err = db.Session(&gorm.Session{}).
+		Select(dayColumn + " AS day, logs.action, COUNT(*) AS count").
+		Group("day, logs.action").
+		Order("day, logs.action").
+		Scan(&stats.PerDay).Error
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Session(&gorm.Session{}).
+		Select("logs.ip AS key, COUNT(*) AS count").
+		Where("logs.ip IS NOT NULL").
+		Group("logs.ip").
+		Order("count DESC, key").
+		Limit(limitOf(input)).
+		Scan(&stats.ByIP).Error
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Session(&gorm.Session{}).
+		Select("logs.metadata->>'email' AS key, COUNT(*) AS count").
+		Where("logs.metadata->>'email' IS NOT NULL").
+		Group("key").
+		Order("count DESC, key").
+		Limit(limitOf(input)).
+		Scan(&stats.ByEmail).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// FileTimeline counts the actions taken on one file per day
+func (ls *LogService) FileTimeline(fileID uint, input AnalyticsInput) ([]ActionCount, error) {
+	db, err := ls.inRange(input)
+	if err != nil {
+		return nil, err
+	}
+	if input.Action != nil {
+		db = db.Where("logs.action = ?", *input.Action)
+	}
+
+	counts := []ActionCount{}
+	err = db.Select(dayColumn+" AS day, logs.action, COUNT(*) AS count").
+		Where("logs.target_type = ? AND logs.target_id = ?", TargetFile, fileID).
+		Group("day, logs.action").
+		Order("day, logs.action").
+		Scan(&counts).Error
+	return counts, err
+}
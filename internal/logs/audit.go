@@ -0,0 +1,217 @@
+package logs
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AuditEntry is one link of the hash-chained audit trail. Each entry's hash
+// covers its own fields and the hash of the entry before it, so editing,
+// removing or reordering rows breaks the chain from that point on. The table
+// is append-only; init.sql rejects updates and deletes with a trigger.
+type AuditEntry struct {
+	// ID is assigned by the chain, not the database, so a gap is detectable
+	ID       uint64  `gorm:"primaryKey;autoIncrement:false" json:"id"`
+	LogID    uint    `gorm:"not null" json:"log_id"`
+	Level    string  `gorm:"size:20;not null" json:"level"`
+	Service  string  `gorm:"size:100;not null" json:"service"`
+	UserID   *uint   `json:"user_id,omitempty"`
+	Action   string  `gorm:"size:255;not null" json:"action"`
+	Message  string  `gorm:"type:text" json:"message"`
+	Metadata *string `gorm:"type:text" json:"metadata,omitempty"`
+
+	TargetType *string `json:"target_type,omitempty"`
+	TargetID   *uint   `json:"target_id,omitempty"`
+	Before     *string `gorm:"type:text" json:"before,omitempty"`
+	After      *string `gorm:"type:text" json:"after,omitempty"`
+	RequestID  *string `json:"request_id,omitempty"`
+	IP         *string `gorm:"column:ip" json:"ip,omitempty"`
+	UserAgent  *string `gorm:"type:text" json:"user_agent,omitempty"`
+
+	// CreatedAt is kept to the microsecond, the precision postgres stores
+	CreatedAt time.Time `json:"created_at"`
+	PrevHash  string    `gorm:"size:64;not null" json:"prev_hash"`
+	Hash      string    `gorm:"size:64;not null" json:"hash"`
+}
+
+func (AuditEntry) TableName() string {
+	return "audit_log"
+}
+
+// MinAuditKeyLength is the shortest AuditKey the server starts with. A short
+// or empty key would let anyone with database access rewrite the chain.
+const MinAuditKeyLength = 32
+
+// SecurityActions are mirrored into the audit trail as well as logs
+var SecurityActions = map[Action]bool{
+	ActionLogin:                 true,
+	ActionLogoutAll:             true,
+	ActionLockout:               true,
+	ActionTwoFactorFailed:       true,
+	ActionEnableTwoFactor:       true,
+	ActionDisableTwoFactor:      true,
+	ActionRecoveryCodeUsed:      true,
+	ActionRefreshTokenReuse:     true,
+	ActionRevokeSession:         true,
+	ActionRevokeUserSessions:    true,
+	ActionSSOProvision:          true,
+	ActionChangePassword:        true,
+	ActionResetPassword:         true,
+	ActionForcePasswordReset:    true,
+	ActionCreateAccessToken:     true,
+	ActionRevokeAccessToken:     true,
+	ActionChangeUserRole:        true,
+	ActionDisableUser:           true,
+	ActionEnableUser:            true,
+	ActionDeleteUser:            true,
+	ActionAnonymiseUser:         true,
+	ActionInviteUser:            true,
+	ActionAcceptInvite:          true,
+	ActionGrantFileAccess:       true,
+	ActionRevokeFileAccess:      true,
+	ActionCreateFilePolicy:      true,
+	ActionDeleteFilePolicy:      true,
+	ActionCreateShareLink:       true,
+	ActionRevokeShareLink:       true,
+	ActionDeleteFile:            true,
+	ActionRevertFile:            true,
+	ActionRestoreFile:           true,
+	ActionReplaceFile:           true,
+	ActionExportFile:            true,
+	ActionDeleteGroup:           true,
+	ActionDeleteCommunity:       true,
+	ActionUpdateFileCommunities: true,
+	ActionExportLogs:            true,
+}
+
+// computeHash returns the keyed hash of an entry. The fields are encoded as
+// a JSON array so the input is unambiguous and stable.
+func (ls *LogService) computeHash(e *AuditEntry) string {
+	payload, _ := json.Marshal([]interface{}{
+		e.ID,
+		e.PrevHash,
+		e.LogID,
+		e.Level,
+		e.Service,
+		e.UserID,
+		e.Action,
+		e.Message,
+		e.Metadata,
+		e.TargetType,
+		e.TargetID,
+		e.Before,
+		e.After,
+		e.RequestID,
+		e.IP,
+		e.UserAgent,
+		e.CreatedAt.UTC().Format(time.RFC3339Nano),
+	})
+
+	mac := hmac.New(sha256.New, ls.AuditKey)
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// appendAudit links a copy of the log row onto the end of the chain. The table
+// lock serialises writers so two entries can't claim the same predecessor.
+func (ls *LogService) appendAudit(tx *gorm.DB, log *SystemLog) error {
+	if err := tx.Exec("LOCK TABLE audit_log IN SHARE ROW EXCLUSIVE MODE").Error; err != nil {
+		return err
+	}
+
+	var last AuditEntry
+	err := tx.Order("id DESC").Limit(1).Find(&last).Error
+	if err != nil {
+		return err
+	}
+
+	entry := AuditEntry{
+		ID:         last.ID + 1,
+		LogID:      log.ID,
+		Level:      log.Level,
+		Service:    log.Service,
+		UserID:     log.UserID,
+		Action:     log.Action,
+		Message:    log.Message,
+		Metadata:   log.Metadata,
+		TargetType: log.TargetType,
+		TargetID:   log.TargetID,
+		Before:     log.Before,
+		After:      log.After,
+		RequestID:  log.RequestID,
+		IP:         log.IP,
+		UserAgent:  log.UserAgent,
+		CreatedAt:  log.CreatedAt.UTC().Truncate(time.Microsecond),
+		PrevHash:   last.Hash,
+	}
+	entry.Hash = ls.computeHash(&entry)
+
+	return tx.Create(&entry).Error
+}
+
+// ChainBreak describes the first entry whose link does not hold
+type ChainBreak struct {
+	ID     uint64 `json:"id"`
+	Reason string `json:"reason"`
+}
+
+type ChainReport struct {
+	Valid   bool        `json:"valid"`
+	Checked int64       `json:"checked"`
+	LastID  uint64      `json:"last_id"`
+	Broken  *ChainBreak `json:"broken,omitempty"`
+}
+
+var errChainBroken = errors.New("audit chain broken")
+
+// checkLink returns why e does not follow the entry with prevID and prevHash,
+// or nil when the link holds
+func (ls *LogService) checkLink(prevID uint64, prevHash string, e *AuditEntry) *ChainBreak {
+	switch {
+	case e.ID != prevID+1:
+		return &ChainBreak{ID: e.ID, Reason: "entries missing before this one"}
+	case e.PrevHash != prevHash:
+		return &ChainBreak{ID: e.ID, Reason: "previous hash does not match the entry before it"}
+	case !hmac.Equal([]byte(e.Hash), []byte(ls.computeHash(e))):
+		return &ChainBreak{ID: e.ID, Reason: "entry contents do not match its hash"}
+	}
+	return nil
+}
+
+// VerifyAuditChain walks the whole trail in order and stops at the first
+// entry that was altered, removed or inserted out of sequence
+func (ls *LogService) VerifyAuditChain() (*ChainReport, error) {
+	report := &ChainReport{Valid: true}
+	prevHash := ""
+	var prevID uint64
+
+	var batch []AuditEntry
+	err := ls.DB.FindInBatches(&batch, 500, func(tx *gorm.DB, _ int) error {
+		for i := range batch {
+			e := &batch[i]
+
+			report.Broken = ls.checkLink(prevID, prevHash, e)
+			if report.Broken != nil {
+				report.Valid = false
+				return errChainBroken
+			}
+
+			report.Checked++
+			report.LastID = e.ID
+			prevID = e.ID
+			prevHash = e.Hash
+		}
+		return nil
+	}).Error
+	if err != nil && !errors.Is(err, errChainBroken) {
+		return nil, err
+	}
+
+	return report, nil
+}
@@ -0,0 +1,207 @@
+package logs
+
+import (
+	"testing"
+	"time"
+)
+
+func strPtr(s string) *string { return &s }
+func uintPtr(u uint) *uint    { return &u }
+
+// chain links entries the way appendAudit does
+func chain(ls *LogService, entries ...AuditEntry) []AuditEntry {
+	prevHash := ""
+	for i := range entries {
+		entries[i].ID = uint64(i + 1)
+		entries[i].PrevHash = prevHash
+		entries[i].Hash = ls.computeHash(&entries[i])
+		prevHash = entries[i].Hash
+	}
+	return entries
+}
+
+func testEntries() []AuditEntry {
+	created := time.Date(2026, 3, 1, 12, 0, 0, 123456000, time.UTC)
+	return []AuditEntry{
+		{LogID: 10, Level: "INFO", Service: "auth", UserID: uintPtr(1), Action: string(ActionLogin), Message: "User logged in", IP: strPtr("10.0.0.1"), CreatedAt: created},
+		{LogID: 11, Level: "WARN", Service: "auth", Action: string(ActionLockout), Message: "Locked login:account:a@b.c", Metadata: strPtr(`{"key":"login:account:a@b.c"}`), CreatedAt: created.Add(time.Second)},
+		{LogID: 12, Level: "INFO", Service: "file", UserID: uintPtr(1), Action: string(ActionDeleteFile), Message: "File deleted", TargetType: strPtr("file"), TargetID: uintPtr(7), Before: strPtr(`{"filename":"a.csv"}`), CreatedAt: created.Add(2 * time.Second)},
+	}
+}
+
+// verify walks the entries like VerifyAuditChain
+func verify(ls *LogService, entries []AuditEntry) *ChainBreak {
+	prevHash := ""
+	var prevID uint64
+	for i := range entries {
+		if broken := ls.checkLink(prevID, prevHash, &entries[i]); broken != nil {
+			return broken
+		}
+		prevID = entries[i].ID
+		prevHash = entries[i].Hash
+	}
+	return nil
+}
+
+func TestComputeHash(t *testing.T) {
+	ls := &LogService{AuditKey: []byte("0123456789abcdef0123456789abcdef")}
+	base := chain(ls, testEntries()...)[2]
+	hash := ls.computeHash(&base)
+
+	if len(hash) != 64 {
+		t.Fatalf("hash %q is not hex SHA-256", hash)
+	}
+	if again := ls.computeHash(&base); again != hash {
+		t.Fatalf("hash is not deterministic: %s then %s", hash, again)
+	}
+
+	local := base
+	local.CreatedAt = base.CreatedAt.In(time.FixedZone("EST", -5*60*60))
+	if got := ls.computeHash(&local); got != hash {
+		t.Error("hash depends on the time zone of CreatedAt")
+	}
+
+	otherKey := &LogService{AuditKey: []byte("fedcba9876543210fedcba9876543210")}
+	if otherKey.computeHash(&base) == hash {
+		t.Error("hash does not depend on the key")
+	}
+
+	tests := []struct {
+		name   string
+		modify func(e *AuditEntry)
+	}{
+		{"id", func(e *AuditEntry) { e.ID++ }},
+		{"prev hash", func(e *AuditEntry) { e.PrevHash = "" }},
+		{"log id", func(e *AuditEntry) { e.LogID++ }},
+		{"level", func(e *AuditEntry) { e.Level = "ERROR" }},
+		{"service", func(e *AuditEntry) { e.Service = "auth" }},
+		{"user id", func(e *AuditEntry) { e.UserID = uintPtr(2) }},
+		{"user id removed", func(e *AuditEntry) { e.UserID = nil }},
+		{"action", func(e *AuditEntry) { e.Action = string(ActionRestoreFile) }},
+		{"message", func(e *AuditEntry) { e.Message = "File restored" }},
+		{"metadata", func(e *AuditEntry) { e.Metadata = strPtr("{}") }},
+		{"target type", func(e *AuditEntry) { e.TargetType = strPtr("user") }},
+		{"target id", func(e *AuditEntry) { e.TargetID = uintPtr(8) }},
+		{"before", func(e *AuditEntry) { e.Before = nil }},
+		{"after", func(e *AuditEntry) { e.After = strPtr(`{"filename":"b.csv"}`) }},
+		{"request id", func(e *AuditEntry) { e.RequestID = strPtr("req-1") }},
+		{"ip", func(e *AuditEntry) { e.IP = strPtr("10.0.0.2") }},
+		{"user agent", func(e *AuditEntry) { e.UserAgent = strPtr("curl") }},
+		{"created at", func(e *AuditEntry) { e.CreatedAt = e.CreatedAt.Add(time.Microsecond) }},
+		// without a structured encoding these two would hash the same input
+		{"text moved between fields", func(e *AuditEntry) { e.Service, e.Action = e.Service+e.Action, "" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := base
+			tt.modify(&e)
+			if ls.computeHash(&e) == hash {
+				t.Errorf("changing the %s does not change the hash", tt.name)
+			}
+		})
+	}
+}
+
+func TestCheckLink(t *testing.T) {
+	ls := &LogService{AuditKey: []byte("0123456789abcdef0123456789abcdef")}
+
+	tests := []struct {
+		name   string
+		tamper func(ls *LogService, entries []AuditEntry) []AuditEntry
+		// brokenID is 0 when the chain should verify
+		brokenID uint64
+		reason   string
+	}{
+		{
+			name:   "intact",
+			tamper: func(_ *LogService, entries []AuditEntry) []AuditEntry { return entries },
+		},
+		{
+			name: "edited message",
+			tamper: func(_ *LogService, entries []AuditEntry) []AuditEntry {
+				entries[1].Message = "nothing happened"
+				return entries
+			},
+			brokenID: 2,
+			reason:   "entry contents do not match its hash",
+		},
+		{
+			name: "edited and rehashed without relinking",
+			tamper: func(ls *LogService, entries []AuditEntry) []AuditEntry {
+				entries[0].Message = "nothing happened"
+				entries[0].Hash = ls.computeHash(&entries[0])
+				return entries
+			},
+			brokenID: 2,
+			reason:   "previous hash does not match the entry before it",
+		},
+		{
+			name: "rehashed with the wrong key",
+			tamper: func(_ *LogService, entries []AuditEntry) []AuditEntry {
+				forger := &LogService{AuditKey: []byte("not the key")}
+				entries[2].Message = "nothing happened"
+				entries[2].Hash = forger.computeHash(&entries[2])
+				return entries
+			},
+			brokenID: 3,
+			reason:   "entry contents do not match its hash",
+		},
+		{
+			name: "middle entry removed",
+			tamper: func(_ *LogService, entries []AuditEntry) []AuditEntry {
+				return append(entries[:1], entries[2])
+			},
+			brokenID: 3,
+			reason:   "entries missing before this one",
+		},
+		{
+			name: "first entry removed",
+			tamper: func(_ *LogService, entries []AuditEntry) []AuditEntry {
+				return entries[1:]
+			},
+			brokenID: 2,
+			reason:   "entries missing before this one",
+		},
+		{
+			name: "entries swapped",
+			tamper: func(_ *LogService, entries []AuditEntry) []AuditEntry {
+				entries[1], entries[2] = entries[2], entries[1]
+				return entries
+			},
+			brokenID: 3,
+			reason:   "entries missing before this one",
+		},
+		{
+			name: "ids renumbered after a removal",
+			tamper: func(ls *LogService, entries []AuditEntry) []AuditEntry {
+				entries = append(entries[:1], entries[2])
+				entries[1].ID = 2
+				entries[1].Hash = ls.computeHash(&entries[1])
+				return entries
+			},
+			brokenID: 2,
+			reason:   "previous hash does not match the entry before it",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries := tt.tamper(ls, chain(ls, testEntries()...))
+			broken := verify(ls, entries)
+
+			if tt.brokenID == 0 {
+				if broken != nil {
+					t.Fatalf("intact chain reported broken at %d: %s", broken.ID, broken.Reason)
+				}
+				return
+			}
+			if broken == nil {
+				t.Fatal("tampering was not detected")
+			}
+			if broken.ID != tt.brokenID || broken.Reason != tt.reason {
+				t.Errorf("broken at %d (%s), want %d (%s)", broken.ID, broken.Reason, tt.brokenID, tt.reason)
+			}
+		})
+	}
+}
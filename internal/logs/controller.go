@@ -1,7 +1,12 @@
 package logs
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -10,7 +15,13 @@ type LogController struct {
 	LogService *LogService
 }
 
+// POST /api/logs returns IPs, user agents and before/after values, so like
+// the other log endpoints it is admin only
 func (lc *LogController) GetLogs(c *gin.Context) {
+	if !lc.requireAdmin(c) {
+		return
+	}
+
 	var input LogFilterInput
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -32,3 +43,223 @@ func (lc *LogController) GetLogs(c *gin.Context) {
 		"total_pages": totalPages,
 	})
 }
+
+// GET /api/logs/export?format=csv|ndjson takes the LogFilterInput fields as
+// query parameters
+func (lc *LogController) ExportLogs(c *gin.Context) {
+	if !lc.requireAdmin(c) {
+		return
+	}
+
+	var input LogFilterInput
+	if err := c.ShouldBindQuery(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	format := c.DefaultQuery("format", ExportCSV)
+	if format != ExportCSV && format != ExportNDJSON {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be csv or ndjson"})
+		return
+	}
+
+	lc.LogService.Record(c, Event{
+		Service:  "logs",
+		Action:   ActionExportLogs,
+		Message:  fmt.Sprintf("Logs exported as %s", format),
+		Metadata: input,
+	})
+
+	filename := fmt.Sprintf("logs-%s.%s", time.Now().Format("20060102-150405"), format)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	// the status is already sent once rows are streaming, so a failure can
+	// only cut the file short
+	var err error
+	if format == ExportCSV {
+		c.Header("Content-Type", "text/csv")
+		err = lc.LogService.WriteLogsCSV(c.Writer, input)
+	} else {
+		c.Header("Content-Type", "application/x-ndjson")
+		err = lc.LogService.WriteLogsNDJSON(c.Writer, input)
+	}
+	if err != nil {
+		fmt.Printf("Failed to write log export: %v\n", err)
+	}
+}
+
+// GET /api/logs/stream sends new entries as server-sent "log" events. It takes
+// the LogFilterInput fields as query parameters.
+func (lc *LogController) StreamLogs(c *gin.Context) {
+	if !lc.requireAdmin(c) {
+		return
+	}
+
+	var input LogFilterInput
+	if err := c.ShouldBindQuery(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	sub := lc.LogService.Subscribe(input)
+	defer lc.LogService.Unsubscribe(sub)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+
+	// proxies drop connections that stay silent too long
+	heartbeat := time.NewTicker(25 * time.Second)
+	defer heartbeat.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case entry, ok := <-sub.C:
+			if !ok {
+				return false
+			}
+			if missed := sub.Missed(); missed > 0 {
+				c.SSEvent("missed", gin.H{"count": missed})
+			}
+			c.SSEvent("log", entry)
+			return true
+		case <-heartbeat.C:
+			c.SSEvent("ping", time.Now().Unix())
+			return true
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
+
+// GET /api/logs/audit/verify
+func (lc *LogController) VerifyAuditChain(c *gin.Context) {
+	if !lc.requireAdmin(c) {
+		return
+	}
+
+	report, err := lc.LogService.VerifyAuditChain()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": report})
+}
+
+// GET /api/logs/analytics/actions
+func (lc *LogController) ActionsPerDay(c *gin.Context) {
+	input, ok := lc.analyticsInput(c)
+	if !ok {
+		return
+	}
+
+	counts, err := lc.LogService.ActionsPerDay(input)
+	lc.analyticsResponse(c, counts, err)
+}
+
+// GET /api/logs/analytics/files
+func (lc *LogController) TopFiles(c *gin.Context) {
+	input, ok := lc.analyticsInput(c)
+	if !ok {
+		return
+	}
+
+	files, err := lc.LogService.TopFiles(input)
+	lc.analyticsResponse(c, files, err)
+}
+
+// GET /api/logs/analytics/users
+func (lc *LogController) TopUsers(c *gin.Context) {
+	input, ok := lc.analyticsInput(c)
+	if !ok {
+		return
+	}
+
+	users, err := lc.LogService.TopUsers(input)
+	lc.analyticsResponse(c, users, err)
+}
+
+// GET /api/logs/analytics/failed-logins
+func (lc *LogController) FailedLogins(c *gin.Context) {
+	input, ok := lc.analyticsInput(c)
+	if !ok {
+		return
+	}
+
+	stats, err := lc.LogService.FailedLogins(input)
+	lc.analyticsResponse(c, stats, err)
+}
+
+// GET /api/logs/analytics/files/:id/timeline
+func (lc *LogController) FileTimeline(c *gin.Context) {
+	input, ok := lc.analyticsInput(c)
+	if !ok {
+		return
+	}
+
+	fileID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file ID"})
+		return
+	}
+
+	counts, err := lc.LogService.FileTimeline(uint(fileID), input)
+	lc.analyticsResponse(c, counts, err)
+}
+
+// analyticsInput checks the caller is an admin and binds the query. It writes
+// the error response itself and returns false on failure.
+func (lc *LogController) analyticsInput(c *gin.Context) (AnalyticsInput, bool) {
+	var input AnalyticsInput
+	if !lc.requireAdmin(c) {
+		return input, false
+	}
+
+	if err := c.ShouldBindQuery(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return input, false
+	}
+	return input, true
+}
+
+func (lc *LogController) analyticsResponse(c *gin.Context, data interface{}, err error) {
+	if err != nil {
+		if errors.Is(err, ErrInvalidRange) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": data})
+}
+
+// requireAdmin writes the error response itself and returns false when the
+// caller is not an admin
+func (lc *LogController) requireAdmin(c *gin.Context) bool {
+	userIDVal, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user ID not found"})
+		return false
+	}
+
+	userID, ok := userIDVal.(float64)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user ID"})
+		return false
+	}
+
+	role, err := lc.LogService.GetUserRole(uint(userID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	if role != "Admin" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only admins can do this"})
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,109 @@
+package logs
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ExportCSV    = "csv"
+	ExportNDJSON = "ndjson"
+)
+
+var exportColumns = []string{
+	"id", "created_at", "level", "service", "action", "message",
+	"user_id", "firstname", "lastname", "target_type", "target_id",
+	"request_id", "ip", "user_agent", "metadata", "before", "after",
+}
+
+// ExportLogs streams every entry matching the filters, newest first, to fn.
+// Paging is ignored.
+func (ls *LogService) ExportLogs(input LogFilterInput, fn func(*LogExportRow) error) error {
+	rows, err := ls.filterLogs(input).Order("logs.created_at DESC, logs.id DESC").Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row LogExportRow
+		if err := ls.DB.ScanRows(rows, &row); err != nil {
+			return err
+		}
+		if err := fn(&row); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// WriteLogsCSV exports the matching entries as CSV with a header row
+func (ls *LogService) WriteLogsCSV(w io.Writer, input LogFilterInput) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(exportColumns); err != nil {
+		return err
+	}
+
+	err := ls.ExportLogs(input, func(row *LogExportRow) error {
+		return writer.Write([]string{
+			strconv.FormatUint(uint64(row.ID), 10),
+			row.CreatedAt.UTC().Format(time.RFC3339),
+			row.Level,
+			row.Service,
+			row.Action,
+			csvCell(row.Message),
+			formatID(row.UserID),
+			csvCell(deref(row.FirstName)),
+			csvCell(deref(row.LastName)),
+			deref(row.TargetType),
+			formatID(row.TargetID),
+			deref(row.RequestID),
+			deref(row.IP),
+			csvCell(deref(row.UserAgent)),
+			csvCell(deref(row.Metadata)),
+			csvCell(deref(row.Before)),
+			csvCell(deref(row.After)),
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// WriteLogsNDJSON exports the matching entries as one JSON object per line
+func (ls *LogService) WriteLogsNDJSON(w io.Writer, input LogFilterInput) error {
+	enc := json.NewEncoder(w)
+	return ls.ExportLogs(input, func(row *LogExportRow) error {
+		return enc.Encode(row)
+	})
+}
+
+// csvCell stops spreadsheets from running user supplied text, such as a file
+// name in a message, as a formula
+func csvCell(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+func formatID(id *uint) string {
+	if id == nil {
+		return ""
+	}
+	return strconv.FormatUint(uint64(*id), 10)
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -13,18 +13,40 @@ type SystemLog struct {
 	Message   string    `gorm:"type:text" json:"message"`
 	Metadata  *string   `gorm:"type:json" json:"metadata,omitempty"`
 	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+
+	TargetType *string `gorm:"size:50" json:"target_type,omitempty"`
+	TargetID   *uint   `json:"target_id,omitempty"`
+	Before     *string `gorm:"type:json" json:"before,omitempty"`
+	After      *string `gorm:"type:json" json:"after,omitempty"`
+	RequestID  *string `gorm:"size:64" json:"request_id,omitempty"`
+	IP         *string `gorm:"column:ip;size:64" json:"ip,omitempty"`
+	UserAgent  *string `gorm:"type:text" json:"user_agent,omitempty"`
 }
 
 type LogFilterInput struct {
-	UserID    *uint   `json:"user_id"`
-	Level     *string `json:"level"`
-	Service   *string `json:"service"`
-	StartDate *string `json:"start_date"` // "YYYY-MM-DD"
-	EndDate   *string `json:"end_date"`
-	Search    *string `json:"search"`
-	Page      int     `json:"page"`
-	Action    *string `json:"action"`
-	PageSize  int     `json:"page_size"`
+	UserID    *uint   `json:"user_id" form:"user_id"`
+	Level     *string `json:"level" form:"level"`
+	Service   *string `json:"service" form:"service"`
+	StartDate *string `json:"start_date" form:"start_date"` // "YYYY-MM-DD"
+	EndDate   *string `json:"end_date" form:"end_date"`
+	Search    *string `json:"search" form:"search"`
+	Page      int     `json:"page" form:"page"`
+	Action    *string `json:"action" form:"action"`
+	PageSize  int     `json:"page_size" form:"page_size"`
+
+	TargetType *string `json:"target_type" form:"target_type"`
+	TargetID   *uint   `json:"target_id" form:"target_id"`
+	// FileID and TargetUserID are shorthands for a file or user target
+	FileID       *uint   `json:"file_id" form:"file_id"`
+	TargetUserID *uint   `json:"target_user_id" form:"target_user_id"`
+	RequestID    *string `json:"request_id" form:"request_id"`
+}
+
+// LogExportRow is a log entry with the acting user's name, as exported
+type LogExportRow struct {
+	SystemLog
+	FirstName *string `gorm:"column:firstname" json:"firstname,omitempty"`
+	LastName  *string `gorm:"column:lastname" json:"lastname,omitempty"`
 }
 
 func (SystemLog) TableName() string {
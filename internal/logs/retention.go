@@ -0,0 +1,162 @@
+package logs
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// RetentionPolicy says how many days entries of each level are kept. The "*"
+// level covers every level not listed; levels without a rule are kept
+// forever. The audit trail is not affected.
+type RetentionPolicy struct {
+	Days map[string]int
+	// ArchiveDir receives expired entries as gzipped NDJSON before they are
+	// deleted
+	ArchiveDir string
+	BatchSize  int
+}
+
+// ArchiveExpired moves entries past their retention into the archive
+// directory, one file per batch, and returns how many were moved per level.
+// A batch is only deleted once its file is safely on disk.
+func (ls *LogService) ArchiveExpired(policy RetentionPolicy) (map[string]int64, error) {
+	if policy.BatchSize <= 0 {
+		policy.BatchSize = 5000
+	}
+	if err := os.MkdirAll(policy.ArchiveDir, 0o700); err != nil {
+		return nil, err
+	}
+
+	var listed []string
+	for level := range policy.Days {
+		if level != "*" {
+			listed = append(listed, level)
+		}
+	}
+
+	archived := map[string]int64{}
+	for level, days := range policy.Days {
+		if days <= 0 {
+			continue
+		}
+		cutoff := time.Now().AddDate(0, 0, -days)
+
+		for {
+			query := ls.DB.Where("created_at < ?", cutoff)
+			if level != "*" {
+				query = query.Where("level = ?", level)
+			} else if len(listed) > 0 {
+				query = query.Where("level NOT IN ?", listed)
+			}
+
+			var batch []SystemLog
+			if err := query.Order("id").Limit(policy.BatchSize).Find(&batch).Error; err != nil {
+				return archived, err
+			}
+			if len(batch) == 0 {
+				break
+			}
+
+			if err := writeArchive(policy.ArchiveDir, level, batch); err != nil {
+				return archived, err
+			}
+
+			ids := make([]uint, len(batch))
+			for i := range batch {
+				ids[i] = batch[i].ID
+			}
+			if err := ls.DB.Where("id IN ?", ids).Delete(&SystemLog{}).Error; err != nil {
+				return archived, err
+			}
+			archived[level] += int64(len(batch))
+
+			if len(batch) < policy.BatchSize {
+				break
+			}
+		}
+	}
+
+	return archived, nil
+}
+
+// writeArchive writes the batch to a temporary file and renames it into place
+// once synced, so a crash never leaves a truncated archive behind
+func writeArchive(dir, level string, batch []SystemLog) error {
+	if level == "*" {
+		level = "other"
+	}
+	name := fmt.Sprintf("logs-%s-%s-%d.ndjson.gz",
+		strings.ToLower(level), time.Now().UTC().Format("20060102T150405"), batch[0].ID)
+	path := filepath.Join(dir, name)
+	tmp := path + ".tmp"
+
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(f)
+	enc := json.NewEncoder(gz)
+	for i := range batch {
+		if err := enc.Encode(&batch[i]); err != nil {
+			f.Close()
+			os.Remove(tmp)
+			return err
+		}
+	}
+	if err := gz.Close(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// StartRetention periodically archives expired entries
+func (ls *LogService) StartRetention(policy RetentionPolicy, interval time.Duration) {
+	if len(policy.Days) == 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			archived, err := ls.ArchiveExpired(policy)
+			if err != nil {
+				log.Printf("Failed to archive expired logs: %v", err)
+			}
+
+			var total int64
+			for _, n := range archived {
+				total += n
+			}
+			if total == 0 {
+				continue
+			}
+
+			log.Printf("Archived %d expired log entries to %s", total, policy.ArchiveDir)
+			if err := ls.Log(LevelInfo, "logs", string(ActionArchiveLogs),
+				fmt.Sprintf("Archived %d expired log entries", total), nil, archived); err != nil {
+				log.Printf("Failed to insert log: %v", err)
+			}
+		}
+	}()
+}
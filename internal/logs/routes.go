@@ -10,9 +10,18 @@ func RegisterRoutes(r *gin.Engine, logService *LogService) {
 	logController := &LogController{LogService: logService}
 
 	userGroup := r.Group("/api/logs")
-	userGroup.Use(middlewares.AuthMiddleware())
+	userGroup.Use(middlewares.AuthMiddleware(middlewares.ScopeLogsRead))
 	{
 		userGroup.POST("", logController.GetLogs)
+		userGroup.GET("/export", logController.ExportLogs)
+		userGroup.GET("/stream", logController.StreamLogs)
+		userGroup.GET("/audit/verify", logController.VerifyAuditChain)
+
+		userGroup.GET("/analytics/actions", logController.ActionsPerDay)
+		userGroup.GET("/analytics/files", logController.TopFiles)
+		userGroup.GET("/analytics/users", logController.TopUsers)
+		userGroup.GET("/analytics/failed-logins", logController.FailedLogins)
+		userGroup.GET("/analytics/files/:id/timeline", logController.FileTimeline)
 	}
 
 }
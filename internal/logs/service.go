@@ -1,8 +1,8 @@
 package logs
 
 import (
-	"encoding/json"
 	"math"
+	"sync"
 	"time"
 
 	"gorm.io/gorm"
@@ -10,31 +10,55 @@ import (
 
 type LogService struct {
 	DB *gorm.DB
-}
+	// AuditKey keys the audit chain hashes, so rewriting the chain needs more
+	// than database access
+	AuditKey []byte
 
-func (ls *LogService) Log(level, service, action, message string, userID *uint, metadata interface{}) error {
-	var metaStr *string
+	writer *writer
 
-	// Convert metadata (map/struct) to JSON string if provided
-	if metadata != nil {
-		if b, err := json.Marshal(metadata); err == nil {
-			str := string(b)
-			metaStr = &str
-		}
-	}
+	// live feeds, see Subscribe
+	subMu      sync.RWMutex
+	subs       map[*Subscription]struct{}
+	subsClosed bool
+}
 
-	log := SystemLog{
+// Log writes an entry outside of a request. Controllers use Record.
+func (ls *LogService) Log(level, service, action, message string, userID *uint, metadata interface{}) error {
+	return ls.write(&SystemLog{
 		Level:     level,
 		Service:   service,
 		UserID:    userID,
 		Action:    action,
 		Message:   message,
-		Metadata:  metaStr,
+		Metadata:  toJSON(metadata),
 		CreatedAt: time.Now(),
+	})
+}
+
+func (ls *LogService) write(log *SystemLog) error {
+	if ls.writer != nil {
+		if queued, err := ls.writer.enqueue(log); queued {
+			return err
+		}
 	}
 
-	return ls.DB.Create(&log).Error
+	var err error
+	if !SecurityActions[Action(log.Action)] {
+		err = ls.DB.Create(log).Error
+	} else {
+		err = ls.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(log).Error; err != nil {
+				return err
+			}
+			return ls.appendAudit(tx, log)
+		})
+	}
+	if err != nil {
+		return err
+	}
 
+	ls.publish(log)
+	return nil
 }
 
 func (ls *LogService) GetLogs(input LogFilterInput) ([]map[string]interface{}, int64, int, error) {
@@ -46,6 +70,29 @@ func (ls *LogService) GetLogs(input LogFilterInput) ([]map[string]interface{}, i
 		input.PageSize = 20
 	}
 
+	db := ls.filterLogs(input)
+
+	// Count total
+	var total int64
+	db.Count(&total)
+
+	// Pagination + query
+	var logs []map[string]interface{}
+	if err := db.
+		Limit(input.PageSize).
+		Offset((input.Page - 1) * input.PageSize).
+		Order("logs.created_at DESC").
+		Find(&logs).Error; err != nil {
+		return nil, 0, 0, err
+	}
+
+	totalPages := int(math.Ceil(float64(total) / float64(input.PageSize)))
+	return logs, total, totalPages, nil
+}
+
+// filterLogs joins the acting user and applies the filters shared by the log
+// list and the export. Without a date range only the last 30 days are kept.
+func (ls *LogService) filterLogs(input LogFilterInput) *gorm.DB {
 	db := ls.DB.Model(&SystemLog{}).
 		Select("logs.*, a.firstname, a.lastname").
 		Joins("LEFT JOIN users a ON logs.user_id = a.id")
@@ -71,6 +118,22 @@ func (ls *LogService) GetLogs(input LogFilterInput) ([]map[string]interface{}, i
 		db = db.Where("logs.action = ?", *input.Action)
 	}
 
+	if input.TargetType != nil {
+		db = db.Where("logs.target_type = ?", *input.TargetType)
+	}
+	if input.TargetID != nil {
+		db = db.Where("logs.target_id = ?", *input.TargetID)
+	}
+	if input.FileID != nil {
+		db = db.Where("logs.target_type = ? AND logs.target_id = ?", TargetFile, *input.FileID)
+	}
+	if input.TargetUserID != nil {
+		db = db.Where("logs.target_type = ? AND logs.target_id = ?", TargetUser, *input.TargetUserID)
+	}
+	if input.RequestID != nil {
+		db = db.Where("logs.request_id = ?", *input.RequestID)
+	}
+
 	// Date range
 	if input.StartDate != nil && input.EndDate != nil {
 		db = db.Where("logs.created_at BETWEEN ? AND ?", *input.StartDate, *input.EndDate)
@@ -89,20 +152,14 @@ func (ls *LogService) GetLogs(input LogFilterInput) ([]map[string]interface{}, i
 		)
 	}
 
-	// Count total
-	var total int64
-	db.Count(&total)
+	return db
+}
 
-	// Pagination + query
-	var logs []map[string]interface{}
-	if err := db.
-		Limit(input.PageSize).
-		Offset((input.Page - 1) * input.PageSize).
-		Order("logs.created_at DESC").
-		Find(&logs).Error; err != nil {
-		return nil, 0, 0, err
+// GetUserRole reads users.role directly; the auth package depends on logs
+func (ls *LogService) GetUserRole(userID uint) (string, error) {
+	var role string
+	if err := ls.DB.Table("users").Select("role").Where("id = ?", userID).Scan(&role).Error; err != nil {
+		return "", err
 	}
-
-	totalPages := int(math.Ceil(float64(total) / float64(input.PageSize)))
-	return logs, total, totalPages, nil
+	return role, nil
 }
@@ -0,0 +1,112 @@
+package logs
+
+import (
+	"strings"
+	"sync/atomic"
+)
+
+// Subscription receives entries matching its filter as they are stored. It
+// only sees entries written by this instance.
+type Subscription struct {
+	C      chan *SystemLog
+	filter LogFilterInput
+	// missed counts entries dropped because the subscriber fell behind
+	missed atomic.Int64
+}
+
+// Missed returns and resets the number of entries dropped since the last call
+func (s *Subscription) Missed() int64 {
+	return s.missed.Swap(0)
+}
+
+// Subscribe starts a live feed of new entries. Dates and paging in the
+// filter are ignored, and Search only matches the level, service, action and
+// message. Call Unsubscribe when done.
+func (ls *LogService) Subscribe(filter LogFilterInput) *Subscription {
+	sub := &Subscription{C: make(chan *SystemLog, 64), filter: filter}
+
+	ls.subMu.Lock()
+	defer ls.subMu.Unlock()
+	if ls.subs == nil {
+		ls.subs = map[*Subscription]struct{}{}
+	}
+	if ls.subsClosed {
+		close(sub.C)
+		return sub
+	}
+	ls.subs[sub] = struct{}{}
+	return sub
+}
+
+func (ls *LogService) Unsubscribe(sub *Subscription) {
+	ls.subMu.Lock()
+	defer ls.subMu.Unlock()
+	if _, ok := ls.subs[sub]; ok {
+		delete(ls.subs, sub)
+		close(sub.C)
+	}
+}
+
+// CloseStreams ends every feed so long-lived requests don't hold up a
+// server shutdown
+func (ls *LogService) CloseStreams() {
+	ls.subMu.Lock()
+	defer ls.subMu.Unlock()
+	ls.subsClosed = true
+	for sub := range ls.subs {
+		delete(ls.subs, sub)
+		close(sub.C)
+	}
+}
+
+// publish hands stored entries to matching subscribers without waiting on
+// slow ones
+func (ls *LogService) publish(entries ...*SystemLog) {
+	ls.subMu.RLock()
+	defer ls.subMu.RUnlock()
+
+	for sub := range ls.subs {
+		for _, entry := range entries {
+			if !sub.filter.matches(entry) {
+				continue
+			}
+			select {
+			case sub.C <- entry:
+			default:
+				sub.missed.Add(1)
+			}
+		}
+	}
+}
+
+func (f *LogFilterInput) matches(e *SystemLog) bool {
+	switch {
+	case f.UserID != nil && (e.UserID == nil || *e.UserID != *f.UserID),
+		f.Level != nil && e.Level != *f.Level,
+		f.Service != nil && e.Service != *f.Service,
+		f.Action != nil && e.Action != *f.Action,
+		f.TargetType != nil && (e.TargetType == nil || *e.TargetType != *f.TargetType),
+		f.TargetID != nil && (e.TargetID == nil || *e.TargetID != *f.TargetID),
+		f.FileID != nil && !hasTarget(e, TargetFile, *f.FileID),
+		f.TargetUserID != nil && !hasTarget(e, TargetUser, *f.TargetUserID),
+		f.RequestID != nil && (e.RequestID == nil || *e.RequestID != *f.RequestID):
+		return false
+	}
+
+	if f.Search != nil && *f.Search != "" {
+		search := strings.ToLower(*f.Search)
+		for _, field := range []string{e.Level, e.Service, e.Action, e.Message} {
+			if strings.Contains(strings.ToLower(field), search) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return true
+}
+
+func hasTarget(e *SystemLog, targetType TargetType, id uint) bool {
+	return e.TargetType != nil && *e.TargetType == string(targetType) &&
+		e.TargetID != nil && *e.TargetID == id
+}
@@ -0,0 +1,340 @@
+package logs
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// What enqueue does when the queue is full
+const (
+	// OverflowBlock waits for room, slowing the request down
+	OverflowBlock = "block"
+	// OverflowDrop discards the entry, except security actions which block
+	OverflowDrop = "drop"
+	// OverflowSpill appends the entry to the spill file for a later replay
+	OverflowSpill = "spill"
+)
+
+// WriterConfig tunes the background writer started by Start
+type WriterConfig struct {
+	QueueSize     int
+	BatchSize     int
+	FlushInterval time.Duration
+	Overflow      string
+	// SpillFile holds entries that could not be written to the database,
+	// one JSON object per line. They are replayed once the database is back.
+	SpillFile string
+}
+
+var ErrLogDropped = errors.New("log queue is full, entry dropped")
+
+// writer batches entries from a bounded queue into the database
+type writer struct {
+	ls   *LogService
+	cfg  WriterConfig
+	done chan struct{}
+
+	// mu guards queue against sends after Close, and spillMu the spill file
+	mu      sync.RWMutex
+	queue   chan *SystemLog
+	closed  bool
+	spillMu sync.Mutex
+
+	dropped atomic.Int64
+	spilled atomic.Int64
+}
+
+// Start switches the service to asynchronous writes. Until it is called, and
+// after Close, entries are written synchronously.
+func (ls *LogService) Start(cfg WriterConfig) {
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 1024
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = time.Second
+	}
+	switch cfg.Overflow {
+	case OverflowBlock, OverflowDrop, OverflowSpill:
+	default:
+		cfg.Overflow = OverflowSpill
+	}
+
+	w := &writer{
+		ls:    ls,
+		cfg:   cfg,
+		done:  make(chan struct{}),
+		queue: make(chan *SystemLog, cfg.QueueSize),
+	}
+	ls.writer = w
+	go w.run()
+}
+
+// Close stops accepting entries and waits for the queue to drain, or for ctx
+// to end, in which case whatever is left goes to the spill file
+func (ls *LogService) Close(ctx context.Context) error {
+	w := ls.writer
+	if w == nil {
+		return nil
+	}
+
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.queue)
+	}
+	w.mu.Unlock()
+
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		// the writer may still be holding a batch, the rest is still queued
+		var rest []*SystemLog
+	drain:
+		for {
+			select {
+			case entry, ok := <-w.queue:
+				if !ok {
+					break drain
+				}
+				rest = append(rest, entry)
+			default:
+				break drain
+			}
+		}
+		if len(rest) > 0 {
+			if err := w.spill(rest); err != nil {
+				return fmt.Errorf("%d log entries lost: %w", len(rest), err)
+			}
+		}
+		return ctx.Err()
+	}
+}
+
+// enqueue hands the entry to the writer, applying the overflow policy when
+// the queue is full. It returns false once the writer is closed.
+func (w *writer) enqueue(entry *SystemLog) (bool, error) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		return false, nil
+	}
+
+	select {
+	case w.queue <- entry:
+		return true, nil
+	default:
+	}
+
+	switch {
+	case w.cfg.Overflow == OverflowSpill:
+		return true, w.spill([]*SystemLog{entry})
+	case w.cfg.Overflow == OverflowDrop && !SecurityActions[Action(entry.Action)]:
+		w.dropped.Add(1)
+		return true, ErrLogDropped
+	default:
+		w.queue <- entry
+		return true, nil
+	}
+}
+
+func (w *writer) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*SystemLog, 0, w.cfg.BatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := w.ls.insertBatch(batch); err != nil {
+			log.Printf("Failed to write %d log entries, spilling to disk: %v", len(batch), err)
+			if err := w.spill(batch); err != nil {
+				log.Printf("Failed to spill %d log entries: %v", len(batch), err)
+			}
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case entry, ok := <-w.queue:
+			if !ok {
+				flush()
+				w.replaySpill()
+				return
+			}
+			batch = append(batch, entry)
+			if len(batch) >= w.cfg.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+			w.replaySpill()
+			w.reportLosses()
+		}
+	}
+}
+
+func (w *writer) reportLosses() {
+	if n := w.dropped.Swap(0); n > 0 {
+		log.Printf("Log queue full, dropped %d entries", n)
+	}
+	if n := w.spilled.Swap(0); n > 0 {
+		log.Printf("Spilled %d log entries to %s", n, w.cfg.SpillFile)
+	}
+}
+
+func (w *writer) spill(entries []*SystemLog) error {
+	if w.cfg.SpillFile == "" {
+		return errors.New("no spill file configured")
+	}
+
+	w.spillMu.Lock()
+	defer w.spillMu.Unlock()
+
+	f, err := os.OpenFile(w.cfg.SpillFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	buf := bufio.NewWriter(f)
+	enc := json.NewEncoder(buf)
+	for _, entry := range entries {
+		if err := enc.Encode(entry); err != nil {
+			return err
+		}
+	}
+	if err := buf.Flush(); err != nil {
+		return err
+	}
+
+	w.spilled.Add(int64(len(entries)))
+	return f.Sync()
+}
+
+// replaySpill moves spilled entries into the database. The spill file is
+// first renamed so requests can keep spilling meanwhile; whatever fails to
+// write stays in the replay file for the next tick. Replayed entries keep
+// their original timestamps.
+func (w *writer) replaySpill() {
+	if w.cfg.SpillFile == "" {
+		return
+	}
+
+	replay := w.cfg.SpillFile + ".replay"
+	if _, err := os.Stat(replay); errors.Is(err, os.ErrNotExist) {
+		w.spillMu.Lock()
+		err := os.Rename(w.cfg.SpillFile, replay)
+		w.spillMu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+
+	f, err := os.Open(replay)
+	if err != nil {
+		log.Printf("Failed to open log replay file: %v", err)
+		return
+	}
+
+	var entries []*SystemLog
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		var entry SystemLog
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			log.Printf("Skipping unreadable spilled log entry: %v", err)
+			continue
+		}
+		entry.ID = 0
+		entries = append(entries, &entry)
+	}
+	err = scanner.Err()
+	f.Close()
+	if err != nil {
+		log.Printf("Failed to read log replay file: %v", err)
+		return
+	}
+
+	for start := 0; start < len(entries); start += w.cfg.BatchSize {
+		end := min(start+w.cfg.BatchSize, len(entries))
+		if err := w.ls.insertBatch(entries[start:end]); err != nil {
+			if err := rewriteSpill(replay, entries[start:]); err != nil {
+				log.Printf("Failed to rewrite log replay file: %v", err)
+			}
+			return
+		}
+	}
+
+	if err := os.Remove(replay); err != nil {
+		log.Printf("Failed to remove log replay file: %v", err)
+		return
+	}
+	log.Printf("Replayed %d spilled log entries", len(entries))
+}
+
+func rewriteSpill(path string, entries []*SystemLog) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+
+	buf := bufio.NewWriter(f)
+	enc := json.NewEncoder(buf)
+	for _, entry := range entries {
+		if err := enc.Encode(entry); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := buf.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// insertBatch writes the entries in one transaction, linking the security
+// actions onto the audit chain in order
+func (ls *LogService) insertBatch(entries []*SystemLog) error {
+	err := ls.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.CreateInBatches(entries, len(entries)).Error; err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if SecurityActions[Action(entry.Action)] {
+				if err := ls.appendAudit(tx, entry); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	ls.publish(entries...)
+	return nil
+}
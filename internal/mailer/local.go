@@ -0,0 +1,46 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// LogMailer only writes messages to the server log. Useful in development
+// where no SMTP server is available.
+type LogMailer struct{}
+
+func (m *LogMailer) Send(msg Message) error {
+	log.Printf("Mail to %s: %s\n%s", strings.Join(msg.To, ", "), msg.Subject, msg.Text)
+	return nil
+}
+
+// FileMailer drops every message as an .eml file in Dir so tests and local
+// runs can inspect what would have been sent
+type FileMailer struct {
+	Dir string
+
+	seq atomic.Uint64
+}
+
+func (m *FileMailer) Send(msg Message) error {
+	dir := m.Dir
+	if dir == "" {
+		dir = "mail"
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	body, err := buildMIME("nordik-drive@localhost", msg)
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%04d.eml", time.Now().Format("20060102T150405.000000000"), m.seq.Add(1))
+	return os.WriteFile(filepath.Join(dir, name), body, 0o644)
+}
@@ -0,0 +1,59 @@
+package mailer
+
+import (
+	"log"
+	"nordik-drive-api/config"
+)
+
+// Message is one email with a plain text body and an optional HTML alternative
+type Message struct {
+	To      []string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Mailer delivers messages. Implementations must be safe for concurrent use.
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// New picks the mailer from MAIL_DRIVER: "smtp" (default), "log" or "file".
+// Without SMTP credentials it falls back to the log mailer so local runs
+// don't try to reach a real server.
+func New(cfg *config.Config) Mailer {
+	switch cfg.MailDriver {
+	case "log":
+		return &LogMailer{}
+	case "file":
+		return &FileMailer{Dir: cfg.MailDropDir}
+	}
+
+	if cfg.GmailUser == "" || cfg.GmailPass == "" {
+		log.Printf("SMTP credentials not set, mail will only be logged")
+		return &LogMailer{}
+	}
+
+	from := cfg.MailFrom
+	if from == "" {
+		from = cfg.GmailUser
+	}
+
+	return &SMTPMailer{
+		Host:     cfg.SMTPHost,
+		Port:     cfg.SMTPPort,
+		Username: cfg.GmailUser,
+		Password: cfg.GmailPass,
+		From:     from,
+	}
+}
+
+// SendTemplate renders the named template with data and sends it to one recipient
+func SendTemplate(m Mailer, to, name string, data any) error {
+	msg, err := Render(name, data)
+	if err != nil {
+		return err
+	}
+	msg.To = []string{to}
+	return m.Send(msg)
+}
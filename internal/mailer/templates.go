@@ -0,0 +1,77 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"strings"
+	texttemplate "text/template"
+)
+
+// Each template name has a <name>.txt file, which must define a "subject"
+// block, and an optional <name>.html file that defines the "content" block
+// of layout.html.
+//
+//go:embed templates/*
+var templateFS embed.FS
+
+var (
+	textTemplates = map[string]*texttemplate.Template{}
+	htmlTemplates = map[string]*htmltemplate.Template{}
+)
+
+func init() {
+	entries, err := fs.ReadDir(templateFS, "templates")
+	if err != nil {
+		panic(err)
+	}
+
+	for _, e := range entries {
+		file := "templates/" + e.Name()
+		name := strings.TrimSuffix(e.Name(), path.Ext(e.Name()))
+
+		switch path.Ext(e.Name()) {
+		case ".txt":
+			textTemplates[name] = texttemplate.Must(texttemplate.ParseFS(templateFS, file))
+		case ".html":
+			if name == "layout" {
+				continue
+			}
+			htmlTemplates[name] = htmltemplate.Must(htmltemplate.ParseFS(templateFS, "templates/layout.html", file))
+		}
+	}
+}
+
+// Render builds the subject and bodies of the named template
+func Render(name string, data any) (Message, error) {
+	text, ok := textTemplates[name]
+	if !ok {
+		return Message{}, fmt.Errorf("unknown mail template: %s", name)
+	}
+
+	var subject, body bytes.Buffer
+	if err := text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return Message{}, err
+	}
+	if err := text.Execute(&body, data); err != nil {
+		return Message{}, err
+	}
+
+	msg := Message{
+		Subject: headerValue(strings.TrimSpace(subject.String())),
+		Text:    strings.TrimSpace(body.String()) + "\n",
+	}
+
+	if html, ok := htmlTemplates[name]; ok {
+		var out bytes.Buffer
+		if err := html.ExecuteTemplate(&out, "layout.html", data); err != nil {
+			return Message{}, err
+		}
+		msg.HTML = out.String()
+	}
+
+	return msg, nil
+}
@@ -2,16 +2,48 @@ package middlewares
 
 import (
 	"net/http"
-	"nordik-drive-api/config"
+	"nordik-drive-api/internal/signing"
+	"slices"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 )
 
-func AuthMiddleware() gin.HandlerFunc {
+// AccessTokens verifies access token signatures, issuer and audience. It is
+// set once at startup.
+var AccessTokens *signing.KeySet
+
+// TokenValidator, when set, runs after the JWT checks so server-side state such
+// as revoked sessions can reject a token before it expires.
+var TokenValidator func(claims jwt.MapClaims) error
+
+// BearerAuthenticator, when set, resolves a personal access token sent as
+// "Authorization: Bearer" to its user and scopes.
+var BearerAuthenticator func(token, ip string) (uint, []string, error)
+
+// Scopes a personal access token can be granted
+const (
+	ScopeFileRead   = "file:read"
+	ScopeFileExport = "file:export"
+	ScopeFileUpload = "file:upload"
+	ScopeFileManage = "file:manage"
+	ScopeLogsRead   = "logs:read"
+)
+
+var Scopes = []string{ScopeFileRead, ScopeFileExport, ScopeFileUpload, ScopeFileManage, ScopeLogsRead}
+
+// AuthMiddleware accepts the access_token cookie, or a personal access token
+// holding every one of scopes. Routes registered without scopes are not
+// available to personal access tokens.
+func AuthMiddleware(scopes ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		cfg := config.LoadConfig()
+		if bearer, ok := bearerToken(c); ok {
+			authenticateBearer(c, bearer, scopes)
+			return
+		}
+
 		accessToken, err := c.Cookie("access_token")
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing access token"})
@@ -19,17 +51,27 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		token, err := jwt.Parse(accessToken, func(token *jwt.Token) (interface{}, error) {
-			return []byte(cfg.JWTSecret), nil
-		})
+		if AccessTokens == nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "token signing keys are not configured"})
+			c.Abort()
+			return
+		}
+
+		claims, err := AccessTokens.Parse(accessToken)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+			c.Abort()
+			return
+		}
 
-		if err != nil || !token.Valid {
+		// only access tokens are signed with these keys, but never accept a
+		// purpose-bound token here
+		if _, isChallenge := claims["purpose"]; isChallenge {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
 			c.Abort()
 			return
 		}
 
-		claims := token.Claims.(jwt.MapClaims)
 		userIDVal := claims["user_id"]
 		var userID float64
 		switch v := userIDVal.(type) {
@@ -49,7 +91,60 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		if TokenValidator != nil {
+			if err := TokenValidator(claims); err != nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+				c.Abort()
+				return
+			}
+		}
+
+		if sid, ok := claims["sid"].(float64); ok {
+			c.Set("sessionID", uint(sid))
+		}
+
 		c.Set("userID", userID)
 		c.Next()
 	}
 }
+
+func bearerToken(c *gin.Context) (string, bool) {
+	header := c.GetHeader("Authorization")
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
+
+func authenticateBearer(c *gin.Context, token string, required []string) {
+	if BearerAuthenticator == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "access tokens are not supported"})
+		c.Abort()
+		return
+	}
+
+	userID, granted, err := BearerAuthenticator(token, c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		c.Abort()
+		return
+	}
+
+	if len(required) == 0 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "this endpoint can't be used with an access token"})
+		c.Abort()
+		return
+	}
+	for _, scope := range required {
+		if !slices.Contains(granted, scope) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "access token is missing the " + scope + " scope"})
+			c.Abort()
+			return
+		}
+	}
+
+	c.Set("userID", float64(userID))
+	c.Set("tokenScopes", granted)
+	c.Next()
+}
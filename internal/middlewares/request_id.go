@@ -0,0 +1,32 @@
+package middlewares
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+// a forwarded ID is kept only if it looks like one, so it can't be used to
+// inject text into the logs
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{8,64}$`)
+
+// RequestID tags every request with an ID, reusing one set by a proxy, and
+// echoes it back so clients can quote it when reporting problems
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			b := make([]byte, 16)
+			rand.Read(b)
+			id = hex.EncodeToString(b)
+		}
+
+		c.Set("requestID", id)
+		c.Header(RequestIDHeader, id)
+		c.Next()
+	}
+}
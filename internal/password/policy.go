@@ -0,0 +1,189 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"nordik-drive-api/config"
+	"os"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// bcrypt ignores everything past 72 bytes
+const maxLength = 72
+
+// Character classes a policy can require
+const (
+	ClassUpper  = "upper"
+	ClassLower  = "lower"
+	ClassDigit  = "digit"
+	ClassSymbol = "symbol"
+)
+
+var Classes = []string{ClassUpper, ClassLower, ClassDigit, ClassSymbol}
+
+// Policy decides which new passwords are acceptable. History is enforced by
+// the caller, which owns the stored hashes.
+type Policy struct {
+	MinLength       int      `json:"min_length"`
+	MaxLength       int      `json:"max_length"`
+	RequiredClasses []string `json:"required_classes"`
+	// History is how many recent passwords, the current one included, can't
+	// be reused
+	History int `json:"history"`
+
+	breached map[[sha1.Size]byte]struct{}
+}
+
+// PolicyError lists every rule a password broke
+type PolicyError struct {
+	Problems []string
+}
+
+func (e *PolicyError) Error() string {
+	return "password " + strings.Join(e.Problems, ", ")
+}
+
+// New builds the policy from config and loads the breached password list if
+// one is configured
+func New(cfg *config.Config) (*Policy, error) {
+	p := &Policy{
+		MinLength: cfg.PasswordMinLength,
+		MaxLength: maxLength,
+		History:   cfg.PasswordHistory,
+	}
+	if p.MinLength < 1 {
+		p.MinLength = 1
+	}
+
+	for _, class := range cfg.PasswordClasses {
+		class = strings.ToLower(class)
+		if !slices.Contains(Classes, class) {
+			return nil, fmt.Errorf("unknown password character class %q", class)
+		}
+		p.RequiredClasses = append(p.RequiredClasses, class)
+	}
+
+	if cfg.BreachedPasswordsFile != "" {
+		breached, err := loadBreached(cfg.BreachedPasswordsFile)
+		if err != nil {
+			return nil, err
+		}
+		p.breached = breached
+		log.Printf("Loaded %d breached password hashes", len(breached))
+	}
+
+	return p, nil
+}
+
+// loadBreached reads SHA-1 hashes, one per line, in either plain hex or the
+// "HASH:COUNT" format of the Pwned Passwords downloads
+func loadBreached(path string) (map[[sha1.Size]byte]struct{}, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open breached password list: %w", err)
+	}
+	defer f.Close()
+
+	breached := make(map[[sha1.Size]byte]struct{})
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		text, _, _ = strings.Cut(text, ":")
+
+		var sum [sha1.Size]byte
+		if len(text) != hex.EncodedLen(sha1.Size) {
+			return nil, fmt.Errorf("breached password list line %d is not a SHA-1 hash", line)
+		}
+		if _, err := hex.Decode(sum[:], []byte(text)); err != nil {
+			return nil, fmt.Errorf("breached password list line %d is not a SHA-1 hash", line)
+		}
+		breached[sum] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read breached password list: %w", err)
+	}
+	return breached, nil
+}
+
+// Breached reports whether the password appears in the breached list
+func (p *Policy) Breached(password string) bool {
+	if len(p.breached) == 0 {
+		return false
+	}
+	_, found := p.breached[sha1.Sum([]byte(password))]
+	return found
+}
+
+// Validate checks length, character classes and the breached list. A
+// *PolicyError is returned when the password is rejected.
+func (p *Policy) Validate(password string) error {
+	var problems []string
+
+	if n := utf8.RuneCountInString(password); n < p.MinLength {
+		problems = append(problems, fmt.Sprintf("must be at least %d characters", p.MinLength))
+	}
+	if len(password) > p.MaxLength {
+		problems = append(problems, fmt.Sprintf("must be at most %d bytes", p.MaxLength))
+	}
+
+	for _, class := range p.RequiredClasses {
+		if !hasClass(password, class) {
+			problems = append(problems, "must contain "+describeClass(class))
+		}
+	}
+
+	if p.Breached(password) {
+		problems = append(problems, "has appeared in a data breach")
+	}
+
+	if len(problems) > 0 {
+		return &PolicyError{Problems: problems}
+	}
+	return nil
+}
+
+func hasClass(password, class string) bool {
+	for _, r := range password {
+		switch class {
+		case ClassUpper:
+			if unicode.IsUpper(r) {
+				return true
+			}
+		case ClassLower:
+			if unicode.IsLower(r) {
+				return true
+			}
+		case ClassDigit:
+			if unicode.IsDigit(r) {
+				return true
+			}
+		case ClassSymbol:
+			if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsSpace(r) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func describeClass(class string) string {
+	switch class {
+	case ClassUpper:
+		return "an uppercase letter"
+	case ClassLower:
+		return "a lowercase letter"
+	case ClassDigit:
+		return "a digit"
+	default:
+		return "a symbol"
+	}
+}
@@ -0,0 +1,277 @@
+package password
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"nordik-drive-api/config"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func sha1Hex(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func writeList(t *testing.T, lines ...string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.Config
+		want    Policy
+		wantErr bool
+	}{
+		{
+			name: "defaults",
+			cfg:  config.Config{},
+			want: Policy{MinLength: 1, MaxLength: maxLength},
+		},
+		{
+			name: "classes are case insensitive",
+			cfg:  config.Config{PasswordMinLength: 12, PasswordHistory: 5, PasswordClasses: []string{"Upper", "DIGIT"}},
+			want: Policy{MinLength: 12, MaxLength: maxLength, History: 5, RequiredClasses: []string{ClassUpper, ClassDigit}},
+		},
+		{
+			name:    "unknown class",
+			cfg:     config.Config{PasswordClasses: []string{"emoji"}},
+			wantErr: true,
+		},
+		{
+			name:    "missing breached list",
+			cfg:     config.Config{BreachedPasswordsFile: filepath.Join(t.TempDir(), "missing.txt")},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := New(&tt.cfg)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.MinLength != tt.want.MinLength || p.MaxLength != tt.want.MaxLength || p.History != tt.want.History {
+				t.Errorf("got %+v, want %+v", *p, tt.want)
+			}
+			if !slices.Equal(p.RequiredClasses, tt.want.RequiredClasses) {
+				t.Errorf("classes = %v, want %v", p.RequiredClasses, tt.want.RequiredClasses)
+			}
+		})
+	}
+}
+
+func TestLoadBreached(t *testing.T) {
+	tests := []struct {
+		name    string
+		lines   []string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:  "plain hex",
+			lines: []string{sha1Hex("password"), sha1Hex("letmein")},
+			want:  []string{"password", "letmein"},
+		},
+		{
+			name:  "pwned passwords format",
+			lines: []string{strings.ToUpper(sha1Hex("password")) + ":3861493", strings.ToUpper(sha1Hex("qwerty")) + ":1"},
+			want:  []string{"password", "qwerty"},
+		},
+		{
+			name:  "blank lines, comments and whitespace",
+			lines: []string{"# top passwords", "", "  " + sha1Hex("dragon") + "  ", "\t"},
+			want:  []string{"dragon"},
+		},
+		{
+			name:    "not hex",
+			lines:   []string{sha1Hex("password"), "not-a-hash"},
+			wantErr: true,
+		},
+		{
+			name:    "too short",
+			lines:   []string{sha1Hex("password")[:38]},
+			wantErr: true,
+		},
+		{
+			name:    "sha256 instead of sha1",
+			lines:   []string{sha1Hex("password") + "0123456789abcdef0123456789abcdef"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			breached, err := loadBreached(writeList(t, tt.lines...))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(breached) != len(tt.want) {
+				t.Fatalf("loaded %d hashes, want %d", len(breached), len(tt.want))
+			}
+			p := &Policy{breached: breached}
+			for _, pw := range tt.want {
+				if !p.Breached(pw) {
+					t.Errorf("%q not found in the list", pw)
+				}
+			}
+		})
+	}
+}
+
+func TestBreached(t *testing.T) {
+	breached, err := loadBreached(writeList(t, sha1Hex("password")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		policy   *Policy
+		password string
+		want     bool
+	}{
+		{"listed", &Policy{breached: breached}, "password", true},
+		{"case matters", &Policy{breached: breached}, "Password", false},
+		{"not listed", &Policy{breached: breached}, "correct horse battery staple", false},
+		{"no list", &Policy{}, "password", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.Breached(tt.password); got != tt.want {
+				t.Errorf("Breached(%q) = %v, want %v", tt.password, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	breached, err := loadBreached(writeList(t, sha1Hex("Password1!")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	all := &Policy{MinLength: 8, MaxLength: maxLength, RequiredClasses: Classes, breached: breached}
+
+	tests := []struct {
+		name     string
+		policy   *Policy
+		password string
+		problems []string
+	}{
+		{
+			name:     "acceptable",
+			policy:   all,
+			password: "Tr0ub4dor&3",
+		},
+		{
+			name:     "too short",
+			policy:   all,
+			password: "Ab1!",
+			problems: []string{"must be at least 8 characters"},
+		},
+		{
+			name:     "length counts characters, not bytes",
+			policy:   &Policy{MinLength: 4, MaxLength: maxLength},
+			password: "ééé",
+			problems: []string{"must be at least 4 characters"},
+		},
+		{
+			name:     "multibyte characters meet the minimum",
+			policy:   &Policy{MinLength: 4, MaxLength: maxLength},
+			password: "éééé",
+		},
+		{
+			name:     "longer than bcrypt reads",
+			policy:   &Policy{MinLength: 1, MaxLength: maxLength},
+			password: strings.Repeat("a", maxLength+1),
+			problems: []string{"must be at most 72 bytes"},
+		},
+		{
+			name:     "exactly the maximum",
+			policy:   &Policy{MinLength: 1, MaxLength: maxLength},
+			password: strings.Repeat("a", maxLength),
+		},
+		{
+			name:     "missing every class",
+			policy:   all,
+			password: "        ",
+			problems: []string{
+				"must contain an uppercase letter",
+				"must contain a lowercase letter",
+				"must contain a digit",
+				"must contain a symbol",
+			},
+		},
+		{
+			name:     "spaces are not symbols",
+			policy:   &Policy{MinLength: 1, MaxLength: maxLength, RequiredClasses: []string{ClassSymbol}},
+			password: "pass word",
+			problems: []string{"must contain a symbol"},
+		},
+		{
+			name:     "non-ascii letters count",
+			policy:   &Policy{MinLength: 1, MaxLength: maxLength, RequiredClasses: []string{ClassUpper, ClassLower}},
+			password: "ÉCOLEé",
+		},
+		{
+			name:     "breached",
+			policy:   all,
+			password: "Password1!",
+			problems: []string{"has appeared in a data breach"},
+		},
+		{
+			name:     "every problem is reported",
+			policy:   all,
+			password: "abc",
+			problems: []string{
+				"must be at least 8 characters",
+				"must contain an uppercase letter",
+				"must contain a digit",
+				"must contain a symbol",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Validate(tt.password)
+			if len(tt.problems) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			var policyErr *PolicyError
+			if !errors.As(err, &policyErr) {
+				t.Fatalf("got %v, want a *PolicyError", err)
+			}
+			if !slices.Equal(policyErr.Problems, tt.problems) {
+				t.Errorf("problems = %q, want %q", policyErr.Problems, tt.problems)
+			}
+		})
+	}
+}
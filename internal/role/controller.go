@@ -80,3 +80,42 @@ func (rc *RoleController) GetRolesByUserId(c *gin.Context) {
 		"roles":   userRoles,
 	})
 }
+
+func (rc *RoleController) SetRequireTwoFactor(c *gin.Context) {
+	userIDVal, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user ID not found"})
+		return
+	}
+
+	userID, ok := userIDVal.(float64)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user ID"})
+		return
+	}
+
+	role, err := rc.RoleService.GetUserRole(int(userID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if role != "Admin" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only admins can change role settings"})
+		return
+	}
+
+	var input RoleTwoFactorInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := rc.RoleService.SetRequireTwoFactor(input.Role, input.Required); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Role two-factor setting updated successfully",
+	})
+}
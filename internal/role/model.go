@@ -1,11 +1,21 @@
 package role
 
 type Role struct {
-	ID            uint   `gorm:"primaryKey" json:"id"`
-	Role          string `gorm:"unique;not null" json:"role"`
-	Priority      uint   `gorm:"not null" json:"priority"`
-	CanUpload     bool   `gorm:"not null" json:"can_upload"`
-	CanView       bool   `gorm:"not null" json:"can_view"`
-	CanApprove    bool   `gorm:"not null" json:"can_approve"`
-	CanApproveAll bool   `gorm:"not null" json:"can_approve_all"`
+	ID               uint   `gorm:"primaryKey" json:"id"`
+	Role             string `gorm:"unique;not null" json:"role"`
+	Priority         uint   `gorm:"not null" json:"priority"`
+	CanUpload        bool   `gorm:"not null" json:"can_upload"`
+	CanView          bool   `gorm:"not null" json:"can_view"`
+	CanApprove       bool   `gorm:"not null" json:"can_approve"`
+	CanApproveAll    bool   `gorm:"not null" json:"can_approve_all"`
+	RequireTwoFactor bool   `gorm:"not null;default:false" json:"require_two_factor"`
+}
+
+type RoleTwoFactorInput struct {
+	Role     string `json:"role" binding:"required"`
+	Required bool   `json:"required"`
+}
+
+func (Role) TableName() string {
+	return "roles"
 }
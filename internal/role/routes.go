@@ -14,6 +14,7 @@ func RegisterRoutes(r *gin.Engine, roleService *RoleService) {
 	{
 		userGroup.GET("", roleController.GetAllRoles)
 		userGroup.GET("/user", roleController.GetRolesByUserId)
+		userGroup.PUT("/two-factor", roleController.SetRequireTwoFactor)
 	}
 
 }
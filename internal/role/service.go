@@ -1,6 +1,7 @@
 package role
 
 import (
+	"errors"
 	"nordik-drive-api/internal/auth"
 
 	"gorm.io/gorm"
@@ -41,3 +42,22 @@ func (rs *RoleService) GetRolesByUserId(userid int) ([]auth.UserRole, error) {
 	}
 	return roles, nil
 }
+
+func (rs *RoleService) GetUserRole(userID int) (string, error) {
+	var user auth.Auth
+	if err := rs.DB.First(&user, userID).Error; err != nil {
+		return "", err
+	}
+	return user.Role, nil
+}
+
+func (rs *RoleService) SetRequireTwoFactor(roleName string, required bool) error {
+	result := rs.DB.Model(&Role{}).Where("role = ?", roleName).Update("require_two_factor", required)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("role not found")
+	}
+	return nil
+}
@@ -0,0 +1,225 @@
+// Package signing holds the asymmetric keys used to sign and verify access
+// tokens. Several keys can be loaded at once so a new key can be introduced
+// and an old one retired without invalidating tokens that are still live.
+package signing
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var ErrInvalidToken = errors.New("invalid or expired token")
+
+type key struct {
+	kid     string
+	method  jwt.SigningMethod
+	private crypto.Signer // nil for verify-only keys
+	public  crypto.PublicKey
+}
+
+// KeySet signs with one active key and verifies with any loaded key
+type KeySet struct {
+	Issuer   string
+	Audience string
+
+	active *key
+	keys   map[string]*key
+}
+
+// Load reads PEM keys from files. Private keys (PKCS#8 RSA or Ed25519, or
+// PKCS#1 RSA) can sign; public keys (PKIX) are only trusted for verification,
+// which is how a retired key is kept until its last tokens expire. activeKID
+// picks the signing key, defaulting to the first private key.
+func Load(paths []string, activeKID, issuer, audience string) (*KeySet, error) {
+	ks := &KeySet{Issuer: issuer, Audience: audience, keys: map[string]*key{}}
+
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		k, err := parsePEM(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		ks.keys[k.kid] = k
+		if ks.active == nil && k.private != nil && (activeKID == "" || activeKID == k.kid) {
+			ks.active = k
+		}
+	}
+
+	if ks.active == nil {
+		if activeKID != "" {
+			return nil, fmt.Errorf("no private key with kid %s", activeKID)
+		}
+		return nil, errors.New("no private signing key loaded")
+	}
+	return ks, nil
+}
+
+// Ephemeral generates a throwaway Ed25519 key for local development. Access
+// tokens stop verifying on restart, which clients recover from by refreshing.
+func Ephemeral(issuer, audience string) (*KeySet, error) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	k, err := newKey(priv, priv.Public())
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("No JWT signing keys configured, using ephemeral key %s", k.kid)
+	return &KeySet{Issuer: issuer, Audience: audience, active: k, keys: map[string]*key{k.kid: k}}, nil
+}
+
+func parsePEM(data []byte) (*key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		signer, ok := parsed.(crypto.Signer)
+		if !ok {
+			return nil, errors.New("unsupported private key")
+		}
+		return newKey(signer, signer.Public())
+	case "RSA PRIVATE KEY":
+		priv, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return newKey(priv, priv.Public())
+	case "PUBLIC KEY":
+		pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return newKey(nil, pub)
+	}
+	return nil, fmt.Errorf("unsupported PEM block %s", block.Type)
+}
+
+func newKey(private crypto.Signer, public crypto.PublicKey) (*key, error) {
+	k := &key{private: private, public: public}
+
+	switch pub := public.(type) {
+	case *rsa.PublicKey:
+		if pub.N.BitLen() < 2048 {
+			return nil, errors.New("RSA keys must be at least 2048 bits")
+		}
+		k.method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		k.method = jwt.SigningMethodEdDSA
+	default:
+		return nil, errors.New("only RSA and Ed25519 keys are supported")
+	}
+
+	k.kid = thumbprint(k.jwk())
+	return k, nil
+}
+
+// jwk returns the required public members in lexicographic order, which is
+// also the canonical form for the RFC 7638 thumbprint
+func (k *key) jwk() [][2]string {
+	b64 := base64.RawURLEncoding.EncodeToString
+	switch pub := k.public.(type) {
+	case *rsa.PublicKey:
+		return [][2]string{{"e", b64(big.NewInt(int64(pub.E)).Bytes())}, {"kty", "RSA"}, {"n", b64(pub.N.Bytes())}}
+	case ed25519.PublicKey:
+		return [][2]string{{"crv", "Ed25519"}, {"kty", "OKP"}, {"x", b64(pub)}}
+	}
+	return nil
+}
+
+func thumbprint(members [][2]string) string {
+	json := "{"
+	for i, m := range members {
+		if i > 0 {
+			json += ","
+		}
+		json += fmt.Sprintf("%q:%q", m[0], m[1])
+	}
+	json += "}"
+	sum := sha256.Sum256([]byte(json))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// Sign signs claims with the active key, adding iss, aud, iat and the kid header
+func (ks *KeySet) Sign(claims jwt.MapClaims) (string, error) {
+	claims["iss"] = ks.Issuer
+	claims["aud"] = ks.Audience
+	claims["iat"] = time.Now().Unix()
+
+	token := jwt.NewWithClaims(ks.active.method, claims)
+	token.Header["kid"] = ks.active.kid
+	return token.SignedString(ks.active.private)
+}
+
+// Parse verifies a token strictly: the kid must name a loaded key, the
+// algorithm must be that key's, and issuer, audience and expiry must be valid
+func (ks *KeySet) Parse(tokenString string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenString, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		k, ok := ks.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown key id %q", kid)
+		}
+		if t.Method.Alg() != k.method.Alg() {
+			return nil, fmt.Errorf("unexpected algorithm %s", t.Method.Alg())
+		}
+		return k.public, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}),
+		jwt.WithIssuer(ks.Issuer),
+		jwt.WithAudience(ks.Audience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidToken
+	}
+	return token.Claims.(jwt.MapClaims), nil
+}
+
+// JWKS returns the public keys as a JSON Web Key Set, active key first
+func (ks *KeySet) JWKS() map[string]interface{} {
+	kids := make([]string, 0, len(ks.keys))
+	for kid := range ks.keys {
+		if kid != ks.active.kid {
+			kids = append(kids, kid)
+		}
+	}
+	sort.Strings(kids)
+	kids = append([]string{ks.active.kid}, kids...)
+
+	keys := make([]map[string]string, 0, len(kids))
+	for _, kid := range kids {
+		k := ks.keys[kid]
+		entry := map[string]string{"kid": k.kid, "use": "sig", "alg": k.method.Alg()}
+		for _, m := range k.jwk() {
+			entry[m[0]] = m[1]
+		}
+		keys = append(keys, entry)
+	}
+	return map[string]interface{}{"keys": keys}
+}
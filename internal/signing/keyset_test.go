@@ -0,0 +1,294 @@
+package signing
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testIssuer   = "nordik-drive-api"
+	testAudience = "nordik-drive"
+)
+
+func mustDecode(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// The expected thumbprints are the worked examples in RFC 7638 section 3.1
+// and RFC 8037 appendix A.3
+func TestThumbprint(t *testing.T) {
+	rsaN := "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw"
+
+	tests := []struct {
+		name   string
+		public interface{}
+		want   string
+	}{
+		{
+			name:   "rsa",
+			public: &rsa.PublicKey{N: new(big.Int).SetBytes(mustDecode(t, rsaN)), E: 65537},
+			want:   "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs",
+		},
+		{
+			name:   "ed25519",
+			public: ed25519.PublicKey(mustDecode(t, "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo")),
+			want:   "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, err := newKey(nil, tt.public)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if k.kid != tt.want {
+				t.Errorf("kid = %s, want %s", k.kid, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewKeyRejects(t *testing.T) {
+	small, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		public interface{}
+	}{
+		{"short rsa key", &small.PublicKey},
+		{"unsupported key type", []byte("not a key")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newKey(nil, tt.public); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func writePEM(t *testing.T, dir, name, blockType string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+
+	edPub, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edDER, err := x509.MarshalPKCS8PrivateKey(edPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPath := writePEM(t, dir, "ed.pem", "PRIVATE KEY", edDER)
+	edKey, _ := newKey(edPriv, edPub)
+
+	rsaPriv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaPath := writePEM(t, dir, "rsa.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaPriv))
+	rsaKey, _ := newKey(rsaPriv, &rsaPriv.PublicKey)
+
+	pubDER, err := x509.MarshalPKIXPublicKey(edPub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubPath := writePEM(t, dir, "ed.pub", "PUBLIC KEY", pubDER)
+	certPath := writePEM(t, dir, "cert.pem", "CERTIFICATE", []byte("x"))
+
+	tests := []struct {
+		name       string
+		paths      []string
+		activeKID  string
+		wantActive string
+		wantKeys   int
+		wantErr    bool
+	}{
+		{name: "first private key is active", paths: []string{pubPath, edPath, rsaPath}, wantActive: edKey.kid, wantKeys: 2},
+		{name: "active kid picks the key", paths: []string{edPath, rsaPath}, activeKID: rsaKey.kid, wantActive: rsaKey.kid, wantKeys: 2},
+		{name: "unknown active kid", paths: []string{edPath}, activeKID: "missing", wantErr: true},
+		{name: "public keys cannot sign", paths: []string{pubPath}, wantErr: true},
+		{name: "public key cannot be the active kid", paths: []string{pubPath, rsaPath}, activeKID: edKey.kid, wantErr: true},
+		{name: "unsupported block", paths: []string{certPath}, wantErr: true},
+		{name: "missing file", paths: []string{filepath.Join(dir, "missing.pem")}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ks, err := Load(tt.paths, tt.activeKID, testIssuer, testAudience)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ks.active.kid != tt.wantActive {
+				t.Errorf("active kid = %s, want %s", ks.active.kid, tt.wantActive)
+			}
+			if len(ks.keys) != tt.wantKeys {
+				t.Errorf("loaded %d keys, want %d", len(ks.keys), tt.wantKeys)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	ks, err := Ephemeral(testIssuer, testAudience)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := Ephemeral(testIssuer, testAudience)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// same keys, different issuer and audience
+	foreignIssuer := &KeySet{Issuer: "someone-else", Audience: testAudience, active: ks.active, keys: ks.keys}
+	foreignAudience := &KeySet{Issuer: testIssuer, Audience: "someone-else", active: ks.active, keys: ks.keys}
+
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{"sub": "42", "exp": time.Now().Add(time.Minute).Unix()}
+	}
+	signed := func(signer *KeySet, claims jwt.MapClaims) string {
+		token, err := signer.Sign(claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	withKID := func(method jwt.SigningMethod, key interface{}) string {
+		claims := valid()
+		claims["iss"] = testIssuer
+		claims["aud"] = testAudience
+		token := jwt.NewWithClaims(method, claims)
+		token.Header["kid"] = ks.active.kid
+		s, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		ok    bool
+	}{
+		{name: "valid", token: signed(ks, valid()), ok: true},
+		{name: "expired", token: signed(ks, jwt.MapClaims{"sub": "42", "exp": time.Now().Add(-time.Minute).Unix()})},
+		{name: "no expiry", token: signed(ks, jwt.MapClaims{"sub": "42"})},
+		{name: "wrong issuer", token: signed(foreignIssuer, valid())},
+		{name: "wrong audience", token: signed(foreignAudience, valid())},
+		{name: "unknown kid", token: signed(other, valid())},
+		// HS256 keyed with the public key is the classic algorithm confusion attack
+		{name: "hmac with the public key", token: withKID(jwt.SigningMethodHS256, []byte(ks.active.public.(ed25519.PublicKey)))},
+		{name: "alg none", token: withKID(jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType)},
+		{name: "garbage", token: "not.a.token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := ks.Parse(tt.token)
+			if !tt.ok {
+				if !errors.Is(err, ErrInvalidToken) {
+					t.Fatalf("got %v, want ErrInvalidToken", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claims["sub"] != "42" || claims["iss"] != testIssuer || claims["aud"] != testAudience {
+				t.Errorf("unexpected claims %v", claims)
+			}
+		})
+	}
+}
+
+func TestParseRejectsWrongAlgorithmForKey(t *testing.T) {
+	rsaPriv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := newKey(rsaPriv, &rsaPriv.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks := &KeySet{Issuer: testIssuer, Audience: testAudience, active: rsaKey, keys: map[string]*key{rsaKey.kid: rsaKey}}
+
+	// PS256 verifies against the same RSA key but is not the key's algorithm
+	token := jwt.NewWithClaims(jwt.SigningMethodPS256, jwt.MapClaims{
+		"iss": testIssuer,
+		"aud": testAudience,
+		"exp": time.Now().Add(time.Minute).Unix(),
+	})
+	token.Header["kid"] = rsaKey.kid
+	s, err := token.SignedString(rsaPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ks.Parse(s); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("got %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	ks, err := Ephemeral(testIssuer, testAudience)
+	if err != nil {
+		t.Fatal(err)
+	}
+	retired, err := Ephemeral(testIssuer, testAudience)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks.keys[retired.active.kid] = &key{kid: retired.active.kid, method: retired.active.method, public: retired.active.public}
+
+	keys := ks.JWKS()["keys"].([]map[string]string)
+	if len(keys) != 2 {
+		t.Fatalf("got %d keys, want 2", len(keys))
+	}
+	if keys[0]["kid"] != ks.active.kid {
+		t.Errorf("first key is %s, want the active key %s", keys[0]["kid"], ks.active.kid)
+	}
+	for _, k := range keys {
+		if k["kty"] != "OKP" || k["crv"] != "Ed25519" || k["alg"] != "EdDSA" || k["use"] != "sig" || k["x"] == "" {
+			t.Errorf("unexpected key %v", k)
+		}
+		if _, ok := k["d"]; ok {
+			t.Errorf("key %s leaks its private part", k["kid"])
+		}
+	}
+}